@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+)
+
+const (
+	INVALID_VALUE_SKIP   = "skip"
+	INVALID_VALUE_REJECT = "reject"
+)
+
+// PropagatedAnnotationSettings defines a namespace annotation whose value is
+// set as a label of the workloads.
+type PropagatedAnnotationSettings struct {
+	Annotation string `json:"annotation"`
+	Label      string `json:"label"`
+	// Sanitize turns the annotation value into a valid label value, instead
+	// of considering it invalid.
+	Sanitize bool `json:"sanitize,omitempty"`
+	// OnInvalid defines what to do when the value is not a valid label
+	// value: `skip` (default) the label or `reject` the request.
+	OnInvalid string `json:"onInvalid,omitempty"`
+}
+
+func (p *PropagatedAnnotationSettings) Valid() error {
+	if p.Annotation == "" {
+		return errors.New("propagatedAnnotations entries require an annotation")
+	}
+	if err := validateLabelKey(p.Label); err != nil {
+		return fmt.Errorf("propagatedAnnotations entry %s: %w", p.Annotation, err)
+	}
+	switch p.OnInvalid {
+	case "", INVALID_VALUE_SKIP, INVALID_VALUE_REJECT:
+	default:
+		return fmt.Errorf("propagatedAnnotations entry %s: onInvalid must be either %q or %q", p.Annotation, INVALID_VALUE_SKIP, INVALID_VALUE_REJECT)
+	}
+	return nil
+}
+
+// namespaceAnnotationLabels returns the labels obtained from the namespace
+// annotations, as defined by the `propagatedAnnotations` settings.
+func namespaceAnnotationLabels(namespace *corev1.Namespace, settings Settings) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, rule := range settings.PropagatedAnnotations {
+		value, found := namespace.Metadata.Annotations[rule.Annotation]
+		if !found {
+			continue
+		}
+		if rule.Sanitize {
+			value = sanitizeLabelValue(value)
+		}
+		if err := validateLabelValue(value); err != nil || value == "" {
+			if rule.OnInvalid == INVALID_VALUE_REJECT {
+				return nil, fmt.Errorf("namespace %s annotation %s cannot be used as value of the %s label: %q is not a valid label value", namespace.Metadata.Name, rule.Annotation, rule.Label, value)
+			}
+			logger.WarnWith("skipping invalid namespace annotation value").
+				String("namespace", namespace.Metadata.Name).
+				String("annotation", rule.Annotation).
+				String("label", rule.Label).
+				Write()
+			continue
+		}
+		labels[rule.Label] = value
+	}
+	return labels, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+)
+
+func TestNamespaceAnnotationLabels(t *testing.T) {
+	namespace := &corev1.Namespace{Metadata: &metav1.ObjectMeta{
+		Name: TEST_NAMESPACE,
+		Annotations: map[string]string{
+			"example.com/cost-center": "finance",
+			"example.com/owner":       "Alice Smith",
+		},
+	}}
+
+	cases := []struct {
+		name           string
+		rules          []PropagatedAnnotationSettings
+		valid          bool
+		expectedLabels map[string]string
+	}{
+		{
+			"valid value",
+			[]PropagatedAnnotationSettings{{Annotation: "example.com/cost-center", Label: "cost-center"}},
+			true,
+			map[string]string{"cost-center": "finance"},
+		},
+		{
+			"missing annotation",
+			[]PropagatedAnnotationSettings{{Annotation: "example.com/team", Label: "team"}},
+			true,
+			map[string]string{},
+		},
+		{
+			"invalid value skipped",
+			[]PropagatedAnnotationSettings{
+				{Annotation: "example.com/owner", Label: "owner"},
+				{Annotation: "example.com/cost-center", Label: "cost-center"},
+			},
+			true,
+			map[string]string{"cost-center": "finance"},
+		},
+		{
+			"invalid value sanitized",
+			[]PropagatedAnnotationSettings{{Annotation: "example.com/owner", Label: "owner", Sanitize: true}},
+			true,
+			map[string]string{"owner": "Alice-Smith"},
+		},
+		{
+			"invalid value rejected",
+			[]PropagatedAnnotationSettings{{Annotation: "example.com/owner", Label: "owner", OnInvalid: INVALID_VALUE_REJECT}},
+			false,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedAnnotations: tc.rules}
+			labels, err := namespaceAnnotationLabels(namespace, settings)
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid to be %t, error: %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestNamespaceAnnotationsArePropagated(t *testing.T) {
+	resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+	payload, err := buildValidationRequest(nil, resource, POD_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.PropagatedAnnotations = []PropagatedAnnotationSettings{{Annotation: "example.com/cost-center", Label: "cost-center"}}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	namespace := &corev1.Namespace{Metadata: &metav1.ObjectMeta{
+		Name:        TEST_NAMESPACE,
+		Labels:      map[string]string{"cost-center": "label-value"},
+		Annotations: map[string]string{"example.com/cost-center": "finance"},
+	}}
+	wapcClient := mocks.NewMockWapcClient(t)
+	mockNamespaces(t, wapcClient, map[string]*corev1.Namespace{TEST_NAMESPACE: namespace})
+	host.Client = wapcClient
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	labels, err := mutatedPodLabels(responsePayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if err := validateLabels(labels, map[string]string{"cost-center": "finance"}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestPropagatedAnnotationsSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  PropagatedAnnotationSettings
+		valid bool
+	}{
+		{"valid rule", PropagatedAnnotationSettings{Annotation: "example.com/owner", Label: "owner", Sanitize: true, OnInvalid: INVALID_VALUE_REJECT}, true},
+		{"missing annotation", PropagatedAnnotationSettings{Label: "owner"}, false},
+		{"invalid label", PropagatedAnnotationSettings{Annotation: "example.com/owner", Label: "not a label"}, false},
+		{"invalid onInvalid", PropagatedAnnotationSettings{Annotation: "example.com/owner", Label: "owner", OnInvalid: "drop"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedAnnotations: []PropagatedAnnotationSettings{tc.rule}}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const (
+	CONFIGMAP_PRECEDENCE_NAMESPACE = "namespace"
+	CONFIGMAP_PRECEDENCE_CONFIGMAP = "configMap"
+
+	CONFIGMAP_MISSING_IGNORE = "ignore"
+	CONFIGMAP_MISSING_REJECT = "reject"
+
+	DEFAULT_CONFIGMAP_KEY = "labels"
+)
+
+// ConfigMapSourceSettings defines the ConfigMap providing label values. The
+// ConfigMap is either defined inside of the namespace of the workload, or it
+// is a central ConfigMap with an entry for each namespace. Each entry holds
+// a `<label>=<value>` pair per line.
+type ConfigMapSourceSettings struct {
+	Name string `json:"name"`
+	// Namespace of the central ConfigMap. When empty, the ConfigMap is read
+	// from the namespace of the workload.
+	Namespace string `json:"namespace,omitempty"`
+	// Key of the entry holding the labels, used only when the ConfigMap is
+	// read from the namespace of the workload. Defaults to `labels`. The
+	// central ConfigMap uses the name of the namespace as key.
+	Key string `json:"key,omitempty"`
+	// Precedence defines whether the values of the `namespace` (default) or
+	// of the `configMap` win when both define the same label.
+	Precedence string `json:"precedence,omitempty"`
+	// OnMissing defines what to do when the ConfigMap, or its entry, does
+	// not exist: `ignore` (default) or `reject` the request.
+	OnMissing string `json:"onMissing,omitempty"`
+}
+
+func (c *ConfigMapSourceSettings) Valid() error {
+	if c.Name == "" {
+		return errors.New("configMap requires a name")
+	}
+	if c.Namespace != "" && c.Key != "" {
+		return errors.New("configMap key cannot be used with a central ConfigMap, the namespace name is used as key")
+	}
+	switch c.Precedence {
+	case "", CONFIGMAP_PRECEDENCE_NAMESPACE, CONFIGMAP_PRECEDENCE_CONFIGMAP:
+	default:
+		return fmt.Errorf("configMap precedence must be either %q or %q", CONFIGMAP_PRECEDENCE_NAMESPACE, CONFIGMAP_PRECEDENCE_CONFIGMAP)
+	}
+	switch c.OnMissing {
+	case "", CONFIGMAP_MISSING_IGNORE, CONFIGMAP_MISSING_REJECT:
+	default:
+		return fmt.Errorf("configMap onMissing must be either %q or %q", CONFIGMAP_MISSING_IGNORE, CONFIGMAP_MISSING_REJECT)
+	}
+	return nil
+}
+
+// location returns the namespace and the key of the ConfigMap entry holding
+// the labels of the given namespace.
+func (c *ConfigMapSourceSettings) location(namespace string) (string, string) {
+	if c.Namespace != "" {
+		return c.Namespace, namespace
+	}
+	if c.Key == "" {
+		return namespace, DEFAULT_CONFIGMAP_KEY
+	}
+	return namespace, c.Key
+}
+
+// parseConfigMapLabels parses the `<label>=<value>` lines of a ConfigMap
+// entry. Empty lines and lines starting with `#` are ignored. Lines with an
+// invalid label key or value are reported as errors.
+func parseConfigMapLabels(entry string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, line := range strings.Split(entry, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		label, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %q must use the <label>=<value> format", line)
+		}
+		label = strings.TrimSpace(label)
+		value = strings.TrimSpace(value)
+		if err := validateLabelKey(label); err != nil {
+			return nil, fmt.Errorf("line %q: %w", line, err)
+		}
+		if err := validateLabelValue(value); err != nil {
+			return nil, fmt.Errorf("line %q: %w", line, err)
+		}
+		labels[label] = value
+	}
+	return labels, nil
+}
+
+// configMapLabels returns the propagation candidates defined by the ConfigMap.
+func configMapLabels(validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	source := settings.ConfigMap
+	if source == nil {
+		return nil, nil
+	}
+
+	namespace, key := source.location(validationRequest.Request.Namespace)
+	configMap := corev1.ConfigMap{}
+	err := fetchResource("v1", "ConfigMap", source.Name, &namespace, settings.cacheDisabled(validationRequest.Request.Operation), &configMap)
+	if err != nil && !isLookupNotFound(err) {
+		return nil, err
+	}
+
+	entry, found := configMap.Data[key]
+	if err != nil || !found {
+		if source.OnMissing == CONFIGMAP_MISSING_REJECT {
+			return nil, &rejectionError{Code: 404, Err: fmt.Errorf("configmap %s/%s is missing the %q entry", namespace, source.Name, key)}
+		}
+		logger.DebugWith("configmap entry not found").
+			String("uid", validationRequest.Request.Uid).
+			String("configMap", namespace+"/"+source.Name).
+			String("key", key).
+			Write()
+		return nil, nil
+	}
+
+	labels, err := parseConfigMapLabels(entry)
+	if err != nil {
+		return nil, &lookupError{Reason: LOOKUP_INVALID, Err: fmt.Errorf("cannot parse configmap %s/%s entry %q: %s", namespace, source.Name, key, err)}
+	}
+	return labels, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+)
+
+// mockConfigMap configures the given client to answer the lookup of the
+// given ConfigMap. A nil data is reported as a missing ConfigMap.
+func mockConfigMap(t *testing.T, wapcClient *mocks.MockWapcClient, namespace, name string, data map[string]string) {
+	request := kubernetes.GetResourceRequest{APIVersion: "v1", Kind: "ConfigMap", Name: name, Namespace: &namespace}
+	if data == nil {
+		mockGetResource(t, wapcClient, request, nil, errors.New(`configmaps "`+name+`" not found: NotFound`))
+		return
+	}
+	mockGetResource(t, wapcClient, request, corev1.ConfigMap{Metadata: &metav1.ObjectMeta{Name: name, Namespace: namespace}, Data: data}, nil)
+}
+
+func TestParseConfigMapLabels(t *testing.T) {
+	labels, err := parseConfigMapLabels("# billing\ncost-center=finance\n\n example.com/owner = team-alpha \n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if err := validateLabels(labels, map[string]string{"cost-center": "finance", "example.com/owner": "team-alpha"}); err != nil {
+		t.Error(err.Error())
+	}
+
+	if _, err := parseConfigMapLabels("cost-center"); err == nil {
+		t.Errorf("Expected an error for lines without a value")
+	}
+	if _, err := parseConfigMapLabels("cost-center=Finance Team"); err == nil {
+		t.Errorf("Expected an error for invalid label values")
+	}
+	if _, err := parseConfigMapLabels("cost center=finance"); err == nil {
+		t.Errorf("Expected an error for invalid label keys")
+	}
+}
+
+func TestConfigMapSource(t *testing.T) {
+	cases := []struct {
+		name           string
+		source         ConfigMapSourceSettings
+		mock           func(*testing.T, *mocks.MockWapcClient)
+		accept         bool
+		expectedLabels map[string]string
+	}{
+		{
+			"configmap in the workload namespace",
+			ConfigMapSourceSettings{Name: "labels"},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockConfigMap(t, wapcClient, TEST_NAMESPACE, "labels", map[string]string{"labels": "owner=team-alpha\ncost-center=configmap"})
+			},
+			SHOULD_ACCEPT,
+			map[string]string{"cost-center": "namespace", "owner": "team-alpha"},
+		},
+		{
+			"configmap with custom key taking precedence",
+			ConfigMapSourceSettings{Name: "labels", Key: "billing", Precedence: CONFIGMAP_PRECEDENCE_CONFIGMAP},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockConfigMap(t, wapcClient, TEST_NAMESPACE, "labels", map[string]string{"billing": "owner=team-alpha\ncost-center=configmap"})
+			},
+			SHOULD_ACCEPT,
+			map[string]string{"cost-center": "configmap", "owner": "team-alpha"},
+		},
+		{
+			"central configmap",
+			ConfigMapSourceSettings{Name: "namespace-labels", Namespace: "kubewarden"},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockConfigMap(t, wapcClient, "kubewarden", "namespace-labels", map[string]string{TEST_NAMESPACE: "owner=team-alpha", "other": "owner=team-beta"})
+			},
+			SHOULD_ACCEPT,
+			map[string]string{"cost-center": "namespace", "owner": "team-alpha"},
+		},
+		{
+			"missing configmap ignored",
+			ConfigMapSourceSettings{Name: "labels"},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockConfigMap(t, wapcClient, TEST_NAMESPACE, "labels", nil)
+			},
+			SHOULD_ACCEPT,
+			map[string]string{"cost-center": "namespace"},
+		},
+		{
+			"missing configmap rejected",
+			ConfigMapSourceSettings{Name: "labels", OnMissing: CONFIGMAP_MISSING_REJECT},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockConfigMap(t, wapcClient, TEST_NAMESPACE, "labels", nil)
+			},
+			SHOULD_REJECT,
+			nil,
+		},
+		{
+			"missing central configmap entry rejected",
+			ConfigMapSourceSettings{Name: "namespace-labels", Namespace: "kubewarden", OnMissing: CONFIGMAP_MISSING_REJECT},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockConfigMap(t, wapcClient, "kubewarden", "namespace-labels", map[string]string{"other": "owner=team-beta"})
+			},
+			SHOULD_REJECT,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+			payload, err := buildValidationRequest([]string{"cost-center", "owner"}, resource, POD_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.ConfigMap = &tc.source
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			wapcClient := mockNamespaceLabels(t, map[string]string{"cost-center": "namespace"})
+			tc.mock(t, wapcClient)
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !tc.accept {
+				response, err := basicResposeValidation(responsePayload, SHOULD_REJECT, NO_MUTATION)
+				if err != nil {
+					t.Fatalf("Unexpected error: %+v", err)
+				}
+				if *response.Code != 404 {
+					t.Errorf("Expected code 404, found %d", *response.Code)
+				}
+				return
+			}
+			labels, err := mutatedPodLabels(responsePayload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestConfigMapSourceSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		source ConfigMapSourceSettings
+		valid  bool
+	}{
+		{"configmap in the workload namespace", ConfigMapSourceSettings{Name: "labels", Key: "billing"}, true},
+		{"central configmap", ConfigMapSourceSettings{Name: "labels", Namespace: "kubewarden", Precedence: CONFIGMAP_PRECEDENCE_CONFIGMAP, OnMissing: CONFIGMAP_MISSING_REJECT}, true},
+		{"missing name", ConfigMapSourceSettings{Namespace: "kubewarden"}, false},
+		{"central configmap with key", ConfigMapSourceSettings{Name: "labels", Namespace: "kubewarden", Key: "billing"}, false},
+		{"invalid precedence", ConfigMapSourceSettings{Name: "labels", Precedence: "tenant"}, false},
+		{"invalid onMissing", ConfigMapSourceSettings{Name: "labels", OnMissing: "fail"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, ConfigMap: &tc.source}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
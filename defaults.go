@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// templateOnlyFields lists the pod spec fields defaulted only inside of the
+// pod templates. The Priority and RuntimeClass admission plugins run before
+// the webhooks and fill `priority` and `overhead` from the classes of the
+// Pod: setting these fields later on a bare Pod leaves them inconsistent, or
+// causes the Pod to be rejected. The Pods created from the templates get the
+// fields before the plugins run.
+var templateOnlyFields = []string{"priorityClassName", "runtimeClassName"}
+
+// PodDefaultsRule defines the values of the pod spec fields used when the
+// namespace label has the given value.
+type PodDefaultsRule struct {
+	Label  string           `json:"label"`
+	Value  string           `json:"value"`
+	Fields PodDefaultFields `json:"fields"`
+}
+
+// PodDefaultFields lists the pod spec fields that can be defaulted.
+type PodDefaultFields struct {
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	RuntimeClassName  string `json:"runtimeClassName,omitempty"`
+	SchedulerName     string `json:"schedulerName,omitempty"`
+}
+
+func (r *PodDefaultsRule) Valid() error {
+	if err := validateLabelKey(r.Label); err != nil {
+		return fmt.Errorf("podDefaults rule: %w", err)
+	}
+	if err := validateLabelValue(r.Value); err != nil {
+		return fmt.Errorf("podDefaults rule %s: %w", r.Label, err)
+	}
+	fields := r.Fields.values()
+	if len(fields) == 0 {
+		return fmt.Errorf("podDefaults rule %s=%s requires at least one field", r.Label, r.Value)
+	}
+	for _, name := range []string{"priorityClassName", "runtimeClassName"} {
+		if value, found := fields[name]; found && (len(value) > LABEL_PREFIX_MAX_LENGTH || !dnsSubdomainRegexp.MatchString(value)) {
+			return fmt.Errorf("podDefaults rule %s=%s: %s %q is not a valid name", r.Label, r.Value, name, value)
+		}
+	}
+	return nil
+}
+
+// values returns the fields that are defined, indexed by their name inside
+// of the pod spec.
+func (f *PodDefaultFields) values() map[string]string {
+	values := make(map[string]string)
+	if f.PriorityClassName != "" {
+		values["priorityClassName"] = f.PriorityClassName
+	}
+	if f.RuntimeClassName != "" {
+		values["runtimeClassName"] = f.RuntimeClassName
+	}
+	if f.SchedulerName != "" {
+		values["schedulerName"] = f.SchedulerName
+	}
+	return values
+}
+
+// podDefaultsMutation returns the mutation setting the pod spec fields
+// defined by the rules matching the candidates. Fields already set by the
+// pod spec are never changed. When more rules define the same field, the
+// first matching one wins. The fields listed inside of `templateOnlyFields`
+// are not set on bare Pods.
+func podDefaultsMutation(gvk kubewarden_protocol.GroupVersionKind, candidates map[string]string, rules []PodDefaultsRule) objectMutation {
+	return func(object map[string]interface{}, podSpec map[string]interface{}) (bool, error) {
+		if podSpec == nil {
+			return false, nil
+		}
+		hasMutation := false
+		for _, rule := range rules {
+			if value, found := candidates[rule.Label]; !found || value != rule.Value {
+				continue
+			}
+			for name, value := range rule.Fields.values() {
+				if gvk == POD_KIND && slices.Contains(templateOnlyFields, name) {
+					continue
+				}
+				if current, found := podSpec[name]; found && current != nil && current != "" {
+					continue
+				}
+				podSpec[name] = value
+				hasMutation = true
+			}
+		}
+		return hasMutation, nil
+	}
+}
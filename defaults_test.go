@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+func TestPodDefaultsMutation(t *testing.T) {
+	rules := []PodDefaultsRule{
+		{Label: "tier", Value: "critical", Fields: PodDefaultFields{PriorityClassName: "high"}},
+		{Label: "sandbox", Value: "true", Fields: PodDefaultFields{RuntimeClassName: "gvisor", PriorityClassName: "sandboxed"}},
+		{Label: "tier", Value: "batch", Fields: PodDefaultFields{SchedulerName: "batch-scheduler"}},
+	}
+
+	cases := []struct {
+		name        string
+		candidates  map[string]string
+		podSpec     string
+		mutated     bool
+		expectedPod string
+	}{
+		{
+			"first matching rule wins",
+			map[string]string{"tier": "critical", "sandbox": "true"},
+			`{}`,
+			true,
+			`{"priorityClassName":"high","runtimeClassName":"gvisor"}`,
+		},
+		{
+			"fields already set",
+			map[string]string{"tier": "critical", "sandbox": "true"},
+			`{"priorityClassName":"low","runtimeClassName":"kata"}`,
+			false,
+			`{"priorityClassName":"low","runtimeClassName":"kata"}`,
+		},
+		{
+			"no matching value",
+			map[string]string{"tier": "standard"},
+			`{}`,
+			false,
+			`{}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			podSpec, err := decodeObject([]byte(tc.podSpec))
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			mutated, err := podDefaultsMutation(DEPLOYMENT_KIND, tc.candidates, rules)(nil, podSpec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if mutated != tc.mutated {
+				t.Errorf("Expected mutated to be %t", tc.mutated)
+			}
+			result, err := json.Marshal(podSpec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if string(result) != tc.expectedPod {
+				t.Errorf("Expected pod spec %s, found %s", tc.expectedPod, result)
+			}
+		})
+	}
+}
+
+func TestPodDefaultsOnBarePods(t *testing.T) {
+	cases := []struct {
+		operation         string
+		expectedScheduler string
+	}{
+		{"CREATE", "batch-scheduler"},
+		{"UPDATE", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.operation, func(t *testing.T) {
+			resource := corev1.Pod{
+				Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE},
+				Spec:     &corev1.PodSpec{},
+			}
+			payload, err := buildValidationRequest([]string{"tier"}, resource, POD_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.PodDefaults = []PodDefaultsRule{{Label: "tier", Value: "critical", Fields: PodDefaultFields{
+					PriorityClassName: "high",
+					RuntimeClassName:  "gvisor",
+					SchedulerName:     "batch-scheduler",
+				}}}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				request.Operation = tc.operation
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			mockNamespaceLabels(t, map[string]string{"tier": "critical"})
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, SHOULD_MUTATE)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			mutatedResourceJSON, err := json.Marshal(response.MutatedObject)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			pod := corev1.Pod{}
+			if err := json.Unmarshal(mutatedResourceJSON, &pod); err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if pod.Spec.SchedulerName != tc.expectedScheduler {
+				t.Errorf("Expected schedulerName %q, found %q", tc.expectedScheduler, pod.Spec.SchedulerName)
+			}
+			if pod.Spec.PriorityClassName != "" || pod.Spec.RuntimeClassName != "" {
+				t.Errorf("Expected priorityClassName and runtimeClassName not to be set on a bare Pod, found %q and %q", pod.Spec.PriorityClassName, pod.Spec.RuntimeClassName)
+			}
+			if err := validateLabels(pod.Metadata.Labels, map[string]string{"tier": "critical"}); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestPodDefaultsSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  PodDefaultsRule
+		valid bool
+	}{
+		{"valid rule", PodDefaultsRule{Label: "tier", Value: "critical", Fields: PodDefaultFields{PriorityClassName: "high", SchedulerName: "Custom Scheduler"}}, true},
+		{"invalid label", PodDefaultsRule{Label: "not a label", Value: "critical", Fields: PodDefaultFields{PriorityClassName: "high"}}, false},
+		{"invalid value", PodDefaultsRule{Label: "tier", Value: "very critical", Fields: PodDefaultFields{PriorityClassName: "high"}}, false},
+		{"no fields", PodDefaultsRule{Label: "tier", Value: "critical"}, false},
+		{"invalid runtime class", PodDefaultsRule{Label: "sandbox", Value: "true", Fields: PodDefaultFields{RuntimeClassName: "gVisor"}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PodDefaults: []PodDefaultsRule{tc.rule}}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
@@ -84,3 +84,42 @@
   [ "$status" -eq 0 ]
   [ $(expr "$output" : '.*allowed.*true') -ne 0 ]
 }
+
+@test "Reject resource when the namespace cannot be found" {
+  run kwctl run --allow-context-aware -r test_data/pod_with_no_labels.json \
+	--replay-host-capabilities-interactions test_data/session_replay_not_found.yml \
+	--settings-path test_data/settings.json annotated-policy.wasm
+
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : '.*allowed.*false') -ne 0 ]
+  [ $(expr "$output" : '.*"code":404.*') -ne 0 ]
+}
+
+@test "Accept resource without changes when the namespace cannot be found and the policy fails open" {
+  run kwctl run --allow-context-aware -r test_data/pod_with_no_labels.json \
+	--replay-host-capabilities-interactions test_data/session_replay_not_found.yml \
+	--settings-path test_data/settings_fail_open.json annotated-policy.wasm
+
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : '.*allowed.*true') -ne 0 ]
+  [ $(expr "$output" : '.*"patchType":"JSONPatch".*') -eq 0 ]
+}
+
+@test "Bypass the cache when fetching the namespace of a resource being created" {
+  run kwctl run --allow-context-aware -r test_data/pod_with_no_labels.json \
+	--replay-host-capabilities-interactions test_data/session_replay_no_cache.yml \
+	--settings-path test_data/settings_no_cache_on_create.json annotated-policy.wasm
+
+  # this prints the output when one the checks below fails
+  echo "output = ${output}"
+
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : '.*allowed.*true') -ne 0 ]
+  [ $(expr "$output" : '.*"patchType":"JSONPatch".*') -ne 0 ]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const (
+	ENV_CONFLICT_KEEP      = "keep"
+	ENV_CONFLICT_OVERWRITE = "overwrite"
+	ENV_CONFLICT_REJECT    = "reject"
+)
+
+// envVarNameRegexp matches the names accepted by Kubernetes for the
+// environment variables of the containers.
+var envVarNameRegexp = regexp.MustCompile(`^[-._a-zA-Z][-._a-zA-Z0-9]*$`)
+
+// containerKeys lists the keys of the pod spec holding containers.
+var containerKeys = []string{"initContainers", "containers"}
+
+// ContainerEnvSettings defines the namespace labels whose values are set as
+// environment variables of all the containers of the pods.
+type ContainerEnvSettings struct {
+	Variables []ContainerEnvVariable `json:"variables"`
+	// OnConflict defines what to do when a container already defines the
+	// variable with a different value: `keep` (default) the value of the
+	// container, `overwrite` it or `reject` the request.
+	OnConflict string `json:"onConflict,omitempty"`
+}
+
+// ContainerEnvVariable maps a namespace label to an environment variable.
+type ContainerEnvVariable struct {
+	Label string `json:"label"`
+	Name  string `json:"name"`
+}
+
+func (c *ContainerEnvSettings) Valid() error {
+	if len(c.Variables) == 0 {
+		return errors.New("containerEnv requires at least one variable")
+	}
+	for _, variable := range c.Variables {
+		if err := validateLabelKey(variable.Label); err != nil {
+			return fmt.Errorf("containerEnv variable %s: %w", variable.Name, err)
+		}
+		if !envVarNameRegexp.MatchString(variable.Name) {
+			return fmt.Errorf("containerEnv variable name %q is not valid", variable.Name)
+		}
+	}
+	switch c.OnConflict {
+	case "", ENV_CONFLICT_KEEP, ENV_CONFLICT_OVERWRITE, ENV_CONFLICT_REJECT:
+	default:
+		return fmt.Errorf("containerEnv onConflict must be one of %q, %q or %q", ENV_CONFLICT_KEEP, ENV_CONFLICT_OVERWRITE, ENV_CONFLICT_REJECT)
+	}
+	return nil
+}
+
+// containerEnvMutation returns the mutation setting the environment
+// variables defined by the settings on all the containers, and init
+// containers, of the pod spec. The pod spec is found using `podSpecPaths`,
+// which covers the same kinds of kubewarden.ExtractPodSpecFromObject while
+// keeping the fields unknown to the k8s-objects library. Labels missing from
+// the candidates are skipped.
+func containerEnvMutation(candidates map[string]string, settings *ContainerEnvSettings) objectMutation {
+	return func(object map[string]interface{}, podSpec map[string]interface{}) (bool, error) {
+		if podSpec == nil {
+			return false, nil
+		}
+		hasMutation := false
+		for _, key := range containerKeys {
+			containers, _ := podSpec[key].([]interface{})
+			for _, item := range containers {
+				container, isMap := item.(map[string]interface{})
+				if !isMap {
+					continue
+				}
+				changed, err := setContainerEnv(container, candidates, settings)
+				if err != nil {
+					return false, err
+				}
+				hasMutation = hasMutation || changed
+			}
+		}
+		return hasMutation, nil
+	}
+}
+
+// setContainerEnv sets the environment variables on the given container.
+// Returns `true` when the container has been changed.
+func setContainerEnv(container map[string]interface{}, candidates map[string]string, settings *ContainerEnvSettings) (bool, error) {
+	env, _ := container["env"].([]interface{})
+	hasMutation := false
+	for _, variable := range settings.Variables {
+		value, found := candidates[variable.Label]
+		if !found {
+			continue
+		}
+		existing := findEnvVar(env, variable.Name)
+		if existing == nil {
+			env = append(env, map[string]interface{}{"name": variable.Name, "value": value})
+			hasMutation = true
+			continue
+		}
+		if _, hasValueFrom := existing["valueFrom"]; !hasValueFrom && existing["value"] == value {
+			continue
+		}
+		switch settings.OnConflict {
+		case ENV_CONFLICT_OVERWRITE:
+			delete(existing, "valueFrom")
+			existing["value"] = value
+			hasMutation = true
+		case ENV_CONFLICT_REJECT:
+			return false, &rejectionError{Code: 400, Err: fmt.Errorf("container %v already defines the %s environment variable", container["name"], variable.Name)}
+		}
+	}
+	if hasMutation {
+		container["env"] = env
+	}
+	return hasMutation, nil
+}
+
+// findEnvVar returns the environment variable with the given name, or nil
+// when it is not defined.
+func findEnvVar(env []interface{}, name string) map[string]interface{} {
+	for _, item := range env {
+		if variable, isMap := item.(map[string]interface{}); isMap && variable["name"] == name {
+			return variable
+		}
+	}
+	return nil
+}
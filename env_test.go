@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	appsv1 "github.com/kubewarden/k8s-objects/api/apps/v1"
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestContainerEnvMutation(t *testing.T) {
+	candidates := map[string]string{"team": "a", "cost-center": "finance"}
+	variables := []ContainerEnvVariable{
+		{Label: "team", Name: "TEAM"},
+		{Label: "cost-center", Name: "COST_CENTER"},
+		{Label: "missing", Name: "MISSING"},
+	}
+
+	cases := []struct {
+		name        string
+		onConflict  string
+		valid       bool
+		mutated     bool
+		expectedEnv string
+	}{
+		{
+			"keep by default",
+			"",
+			true,
+			true,
+			`[{"name":"TEAM","value":"b"},{"name":"COST_CENTER","value":"finance"}]`,
+		},
+		{
+			"overwrite",
+			ENV_CONFLICT_OVERWRITE,
+			true,
+			true,
+			`[{"name":"TEAM","value":"a"},{"name":"COST_CENTER","value":"finance"}]`,
+		},
+		{
+			"reject",
+			ENV_CONFLICT_REJECT,
+			false,
+			false,
+			"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			object, err := decodeObject([]byte(`{"spec": {
+				"initContainers": [{"name": "init"}],
+				"containers": [{"name": "app", "env": [{"name": "TEAM", "value": "b"}]}]
+			}}`))
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			podSpec, _ := nestedMap(object, "spec")
+
+			mutation := containerEnvMutation(candidates, &ContainerEnvSettings{Variables: variables, OnConflict: tc.onConflict})
+			mutated, err := mutation(object, podSpec)
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid to be %t, error: %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+			if mutated != tc.mutated {
+				t.Errorf("Expected mutated to be %t", tc.mutated)
+			}
+
+			initEnv, err := json.Marshal(podSpec["initContainers"].([]interface{})[0].(map[string]interface{})["env"])
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if string(initEnv) != `[{"name":"TEAM","value":"a"},{"name":"COST_CENTER","value":"finance"}]` {
+				t.Errorf("Unexpected init container env: %s", initEnv)
+			}
+			env, err := json.Marshal(podSpec["containers"].([]interface{})[0].(map[string]interface{})["env"])
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if string(env) != tc.expectedEnv {
+				t.Errorf("Expected env %s, found %s", tc.expectedEnv, env)
+			}
+		})
+	}
+}
+
+func TestContainerEnvMutationIsIdempotent(t *testing.T) {
+	object, err := decodeObject([]byte(`{"spec": {"containers": [{"name": "app", "env": [{"name": "TEAM", "value": "a"}]}]}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	podSpec, _ := nestedMap(object, "spec")
+
+	settings := &ContainerEnvSettings{Variables: []ContainerEnvVariable{{Label: "team", Name: "TEAM"}}, OnConflict: ENV_CONFLICT_REJECT}
+	mutated, err := containerEnvMutation(map[string]string{"team": "a"}, settings)(object, podSpec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if mutated {
+		t.Errorf("Containers already defining the expected value should not be changed")
+	}
+}
+
+func TestContainerEnvIsInjected(t *testing.T) {
+	containerName := "app"
+	resource := appsv1.Deployment{
+		Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE},
+		Spec: &appsv1.DeploymentSpec{
+			Template: &corev1.PodTemplateSpec{
+				Metadata: &metav1.ObjectMeta{},
+				Spec:     &corev1.PodSpec{Containers: []*corev1.Container{{Name: &containerName}}},
+			},
+		},
+	}
+	payload, err := buildValidationRequest(nil, resource, DEPLOYMENT_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.ContainerEnv = &ContainerEnvSettings{Variables: []ContainerEnvVariable{{Label: "team", Name: "TEAM"}}}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	mockNamespaceLabels(t, map[string]string{"team": "a"})
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, SHOULD_MUTATE)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	mutatedResourceJSON, err := json.Marshal(response.MutatedObject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	deployment := appsv1.Deployment{}
+	if err := json.Unmarshal(mutatedResourceJSON, &deployment); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	env := deployment.Spec.Template.Spec.Containers[0].Env
+	if len(env) != 1 || env[0].Name == nil || *env[0].Name != "TEAM" || env[0].Value != "a" {
+		t.Errorf("Unexpected container env: %s", mutatedResourceJSON)
+	}
+	if len(deployment.Metadata.Labels) != 0 {
+		t.Errorf("No label should be propagated, found: %v", deployment.Metadata.Labels)
+	}
+}
+
+func TestContainerEnvSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings ContainerEnvSettings
+		valid    bool
+	}{
+		{"valid settings", ContainerEnvSettings{Variables: []ContainerEnvVariable{{Label: "team", Name: "TEAM"}}, OnConflict: ENV_CONFLICT_OVERWRITE}, true},
+		{"no variables", ContainerEnvSettings{}, false},
+		{"invalid label", ContainerEnvSettings{Variables: []ContainerEnvVariable{{Label: "not a label", Name: "TEAM"}}}, false},
+		{"invalid name", ContainerEnvSettings{Variables: []ContainerEnvVariable{{Label: "team", Name: "1TEAM"}}}, false},
+		{"invalid onConflict", ContainerEnvSettings{Variables: []ContainerEnvVariable{{Label: "team", Name: "TEAM"}}, OnConflict: "merge"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{ContainerEnv: &tc.settings}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
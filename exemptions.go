@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const SERVICE_ACCOUNT_USERNAME_PREFIX = "system:serviceaccount:"
+
+func (s *Settings) validateExemptions() error {
+	if slices.Contains(s.ExemptUsernames, "") {
+		return errors.New("exemptUsernames cannot contain empty usernames")
+	}
+	if slices.Contains(s.ExemptGroups, "") {
+		return errors.New("exemptGroups cannot contain empty groups")
+	}
+	for _, serviceAccount := range s.ExemptServiceAccounts {
+		namespace, name, found := strings.Cut(serviceAccount, ":")
+		if !found || namespace == "" || name == "" || strings.Contains(name, ":") {
+			return fmt.Errorf("exemptServiceAccounts entry %q must use the <namespace>:<name> format", serviceAccount)
+		}
+	}
+	return nil
+}
+
+// exemptionReason returns the reason why the user who made the request is
+// exempted from the label propagation. An empty string is returned when the
+// user is not exempted.
+func (s *Settings) exemptionReason(userInfo kubewarden_protocol.UserInfo) string {
+	if slices.Contains(s.ExemptUsernames, userInfo.Username) {
+		return fmt.Sprintf("username %s is exempted", userInfo.Username)
+	}
+	for _, group := range userInfo.Groups {
+		if slices.Contains(s.ExemptGroups, group) {
+			return fmt.Sprintf("group %s is exempted", group)
+		}
+	}
+	if serviceAccount, isServiceAccount := strings.CutPrefix(userInfo.Username, SERVICE_ACCOUNT_USERNAME_PREFIX); isServiceAccount {
+		if slices.Contains(s.ExemptServiceAccounts, serviceAccount) {
+			return fmt.Sprintf("service account %s is exempted", serviceAccount)
+		}
+	}
+	return ""
+}
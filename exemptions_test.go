@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+func TestExemptionReason(t *testing.T) {
+	settings := Settings{
+		PropagatedLabels:      []string{"testing"},
+		ExemptUsernames:       []string{"break-glass-admin"},
+		ExemptGroups:          []string{"backup-operators"},
+		ExemptServiceAccounts: []string{"migration:migrator"},
+	}
+
+	cases := []struct {
+		name     string
+		userInfo kubewarden_protocol.UserInfo
+		exempted bool
+	}{
+		{"exempted username", kubewarden_protocol.UserInfo{Username: "break-glass-admin"}, true},
+		{"exempted group", kubewarden_protocol.UserInfo{Username: "velero", Groups: []string{"system:authenticated", "backup-operators"}}, true},
+		{"exempted service account", kubewarden_protocol.UserInfo{Username: "system:serviceaccount:migration:migrator"}, true},
+		{"service account in another namespace", kubewarden_protocol.UserInfo{Username: "system:serviceaccount:default:migrator"}, false},
+		{"regular user", kubewarden_protocol.UserInfo{Username: "alice", Groups: []string{"system:authenticated"}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason := settings.exemptionReason(tc.userInfo)
+			if (reason != "") != tc.exempted {
+				t.Errorf("Expected exempted to be %t, found reason %q", tc.exempted, reason)
+			}
+		})
+	}
+}
+
+func TestExemptionsSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings Settings
+		valid    bool
+	}{
+		{"valid exemptions", Settings{PropagatedLabels: []string{"testing"}, ExemptUsernames: []string{"admin"}, ExemptGroups: []string{"admins"}, ExemptServiceAccounts: []string{"kube-system:backup"}}, true},
+		{"empty username", Settings{PropagatedLabels: []string{"testing"}, ExemptUsernames: []string{""}}, false},
+		{"empty group", Settings{PropagatedLabels: []string{"testing"}, ExemptGroups: []string{""}}, false},
+		{"service account without namespace", Settings{PropagatedLabels: []string{"testing"}, ExemptServiceAccounts: []string{"backup"}}, false},
+		{"service account with empty name", Settings{PropagatedLabels: []string{"testing"}, ExemptServiceAccounts: []string{"kube-system:"}}, false},
+		{"service account username", Settings{PropagatedLabels: []string{"testing"}, ExemptServiceAccounts: []string{"system:serviceaccount:kube-system:backup"}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			valid, _ := tc.settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
+
+func TestExemptedRequestIsAcceptedWithoutChanges(t *testing.T) {
+	resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+	payload, err := buildValidationRequest([]string{"testing"}, resource, POD_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.ExemptGroups = []string{"backup-operators"}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+		request.UserInfo = kubewarden_protocol.UserInfo{Username: "velero", Groups: []string{"backup-operators"}}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	// exempted requests must not trigger any namespace lookup
+	host.Client = mocks.NewMockWapcClient(t)
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, NO_MUTATION)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if response.MutatedObject != nil {
+		t.Errorf("Exempted request should not be mutated")
+	}
+}
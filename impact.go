@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// impactKinds lists the kinds whose resources are inspected when reporting
+// the impact of a namespace label change: the supported kinds that live
+// inside of a namespace.
+var impactKinds = []kubewarden_protocol.GroupVersionKind{
+	POD_KIND,
+	REPLICATIONCONTROLLER_KIND,
+	DEPLOYMENT_KIND,
+	REPLICASET_KIND,
+	STATEFULSET_KIND,
+	DAEMONSET_KIND,
+	JOB_KIND,
+	CRONJOB_KIND,
+}
+
+// apiVersion returns the API version of the given kind, as used by the
+// host capabilities.
+func apiVersion(gvk kubewarden_protocol.GroupVersionKind) string {
+	if gvk.Group == "" {
+		return gvk.Version
+	}
+	return gvk.Group + "/" + gvk.Version
+}
+
+// expectedLabels returns the values the policy propagates, for the changed
+// namespace labels, when the workloads of the namespace are updated. Labels
+// removed from the namespace, set only on creation, or whose static value
+// takes precedence are never changed. The values not allowed by
+// `labelValues` are replaced by their default or dropped, like it happens at
+// workload admission.
+func expectedLabels(labels map[string]string, changed []string, settings Settings) map[string]string {
+	expected := make(map[string]string)
+	for _, label := range changed {
+		value, found := labels[label]
+		if !found || slices.Contains(settings.OnCreateOnly, label) {
+			continue
+		}
+		if _, static := settings.StaticLabels[label]; static && settings.StaticLabelsPrecedence == STATIC_LABELS_PRECEDENCE_STATIC {
+			continue
+		}
+		expected[label] = value
+	}
+	for _, rule := range settings.LabelValues {
+		value, found := expected[rule.Label]
+		if !found || rule.check(value) == nil {
+			continue
+		}
+		if rule.OnInvalid == INVALID_VALUE_DEFAULT {
+			expected[rule.Label] = rule.Default
+		} else {
+			delete(expected, rule.Label)
+		}
+	}
+	return expected
+}
+
+// outdatedResources returns the number of resources of the given kind, in
+// the namespace, whose labels do not match the expected values. The labels
+// a resource opts out of, or overrides, through the workload annotations are
+// not compared.
+func outdatedResources(gvk kubewarden_protocol.GroupVersionKind, namespace string, expected map[string]string, settings Settings) (int, error) {
+	responseBytes, err := kubernetes.ListResourcesByNamespace(&host, kubernetes.ListResourcesByNamespaceRequest{
+		APIVersion: apiVersion(gvk),
+		Kind:       gvk.Kind,
+		Namespace:  namespace,
+	})
+	if err != nil {
+		return 0, err
+	}
+	list := struct {
+		Items []struct {
+			Metadata *metav1.ObjectMeta `json:"metadata"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(responseBytes, &list); err != nil {
+		return 0, err
+	}
+
+	outdated := 0
+	for _, item := range list.Items {
+		metadata := item.Metadata
+		if metadata == nil {
+			metadata = &metav1.ObjectMeta{}
+		}
+		var overrides workloadOverrides
+		if settings.WorkloadOverrides != nil {
+			// workloads with invalid annotations are rejected, hence never
+			// updated
+			overrides, err = parseWorkloadOverrides(metadata.Annotations, settings.propagatedLabelKeys())
+			if err != nil {
+				continue
+			}
+		}
+		for label, value := range expected {
+			if _, overridden := overrides.Values[label]; overridden || slices.Contains(overrides.OptOut, label) {
+				continue
+			}
+			if itemValue, found := metadata.Labels[label]; !found || itemValue != value {
+				outdated++
+				break
+			}
+		}
+	}
+	return outdated, nil
+}
+
+// reportNamespaceImpact logs how many resources of the namespace carry
+// propagated labels that are outdated by the namespace update. The report
+// never blocks the update: resources that cannot be listed are reported as
+// a warning and skipped. Nothing is listed when the update does not change
+// any label the policy would propagate to the existing workloads.
+func reportNamespaceImpact(request kubewarden_protocol.KubernetesAdmissionRequest, labels, oldLabels map[string]string, settings Settings) {
+	expected := expectedLabels(labels, changedPropagatedLabels(labels, oldLabels, settings), settings)
+	if len(expected) == 0 {
+		return
+	}
+	changed := make([]string, 0, len(expected))
+	for label := range expected {
+		changed = append(changed, label)
+	}
+	slices.Sort(changed)
+
+	counts := make([]int, len(impactKinds))
+	listed := make([]bool, len(impactKinds))
+	total := 0
+	for i, gvk := range impactKinds {
+		outdated, err := outdatedResources(gvk, request.Name, expected, settings)
+		if err != nil {
+			logger.WarnWith("cannot list resources to report namespace impact").
+				String("uid", request.Uid).
+				String("namespace", request.Name).
+				String("kind", formatGVK(gvk)).
+				Err("error", err).
+				Write()
+			continue
+		}
+		counts[i] = outdated
+		listed[i] = true
+		total += outdated
+	}
+
+	summary := logger.InfoWith("namespace label change impact").
+		String("uid", request.Uid).
+		String("namespace", request.Name).
+		String("labels", strings.Join(changed, ", "))
+	for i, gvk := range impactKinds {
+		if listed[i] {
+			summary = summary.Int(gvk.Kind, counts[i])
+		}
+	}
+	summary.Int("outdated", total).Write()
+}
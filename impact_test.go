@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// mockListResources configures the given client to answer the listing of
+// the resources of the given kind inside of the `team-a` namespace, with the
+// given metadata.
+func mockListResources(t *testing.T, wapcClient *mocks.MockWapcClient, gvk kubewarden_protocol.GroupVersionKind, metadata []metav1.ObjectMeta, err error) {
+	wapcRequest, marshalErr := json.Marshal(&kubernetes.ListResourcesByNamespaceRequest{
+		APIVersion: apiVersion(gvk),
+		Kind:       gvk.Kind,
+		Namespace:  "team-a",
+	})
+	if marshalErr != nil {
+		t.Fatalf("Cannot create wapcRequest payload: %+v", marshalErr)
+	}
+	items := []map[string]interface{}{}
+	for _, itemMetadata := range metadata {
+		items = append(items, map[string]interface{}{"metadata": itemMetadata})
+	}
+	wapcResponse, marshalErr := json.Marshal(map[string]interface{}{"items": items})
+	if marshalErr != nil {
+		t.Fatalf("Cannot create wapcResponse payload: %+v", marshalErr)
+	}
+	wapcClient.On("HostCall", "kubewarden", "kubernetes", "list_resources_by_namespace", wapcRequest).Return(wapcResponse, err)
+}
+
+func TestOutdatedResources(t *testing.T) {
+	wapcClient := mocks.NewMockWapcClient(t)
+	mockListResources(t, wapcClient, DEPLOYMENT_KIND, []metav1.ObjectMeta{
+		{Name: "up-to-date", Labels: map[string]string{"cost-center": "engineering", "team": "a"}},
+		{Name: "outdated", Labels: map[string]string{"cost-center": "finance", "team": "a"}},
+		{Name: "missing-label", Labels: map[string]string{"cost-center": "engineering"}},
+		{Name: "no-labels"},
+		{Name: "opted-out", Labels: map[string]string{"cost-center": "finance", "team": "a"}, Annotations: map[string]string{OPT_OUT_ANNOTATION: "cost-center"}},
+		{Name: "overridden", Labels: map[string]string{"cost-center": "shared", "team": "a"}, Annotations: map[string]string{OVERRIDE_ANNOTATION: "cost-center=shared"}},
+	}, nil)
+	host.Client = wapcClient
+
+	settings := Settings{PropagatedLabels: []string{"cost-center", "team"}, WorkloadOverrides: &testWorkloadOverrides}
+	outdated, err := outdatedResources(DEPLOYMENT_KIND, "team-a", map[string]string{"cost-center": "engineering", "team": "a"}, settings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if outdated != 3 {
+		t.Errorf("Expected 3 outdated resources, found %d", outdated)
+	}
+}
+
+func TestExpectedLabels(t *testing.T) {
+	cases := []struct {
+		name     string
+		labels   map[string]string
+		settings Settings
+		expected map[string]string
+	}{
+		{
+			"changed labels",
+			map[string]string{"cost-center": "engineering", "team": "a"},
+			Settings{},
+			map[string]string{"cost-center": "engineering", "team": "a"},
+		},
+		{
+			"removed label",
+			map[string]string{"team": "a"},
+			Settings{},
+			map[string]string{"team": "a"},
+		},
+		{
+			"label set only on creation",
+			map[string]string{"cost-center": "engineering", "team": "a"},
+			Settings{OnCreateOnly: []string{"cost-center"}},
+			map[string]string{"team": "a"},
+		},
+		{
+			"static label taking precedence",
+			map[string]string{"cost-center": "engineering", "team": "a"},
+			Settings{StaticLabels: map[string]string{"cost-center": "shared"}, StaticLabelsPrecedence: STATIC_LABELS_PRECEDENCE_STATIC},
+			map[string]string{"team": "a"},
+		},
+		{
+			"label values",
+			map[string]string{"cost-center": "engineering", "team": "a"},
+			Settings{LabelValues: []LabelValueSettings{
+				{LabelValueConstraint: LabelValueConstraint{Label: "cost-center", Values: []string{"finance"}}, OnInvalid: INVALID_VALUE_DEFAULT, Default: "unassigned"},
+				{LabelValueConstraint: LabelValueConstraint{Label: "team", Values: []string{"b"}}},
+			}},
+			map[string]string{"cost-center": "unassigned"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := expectedLabels(tc.labels, []string{"cost-center", "team"}, tc.settings)
+			if len(expected) != len(tc.expected) {
+				t.Fatalf("Expected labels %v, found %v", tc.expected, expected)
+			}
+			if err := validateLabels(expected, tc.expected); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestNamespaceImpactReportDoesNotBlockUpdates(t *testing.T) {
+	payload := namespaceRequest(t, "UPDATE", map[string]string{"cost-center": "engineering"}, func(settings *Settings) {
+		settings.ReportNamespaceImpact = true
+	})
+	payload, err := updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+		oldObject, err := json.Marshal(corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"cost-center": "finance"}}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		request.OldObject = oldObject
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	wapcClient := mocks.NewMockWapcClient(t)
+	for _, gvk := range impactKinds {
+		switch gvk {
+		case POD_KIND:
+			mockListResources(t, wapcClient, gvk, nil, errors.New("connection refused"))
+		case DEPLOYMENT_KIND:
+			mockListResources(t, wapcClient, gvk, []metav1.ObjectMeta{{Name: "test", Labels: map[string]string{"cost-center": "finance"}}}, nil)
+		default:
+			mockListResources(t, wapcClient, gvk, nil, nil)
+		}
+	}
+	host.Client = wapcClient
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if _, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, NO_MUTATION); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestNamespaceImpactIsNotReportedWithoutChanges(t *testing.T) {
+	cases := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{"propagated labels unchanged", map[string]string{"cost-center": "finance", "other": "changed"}},
+		// the policy never removes labels from the workloads
+		{"propagated label removed", map[string]string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := namespaceRequest(t, "UPDATE", tc.labels, func(settings *Settings) {
+				settings.ReportNamespaceImpact = true
+			})
+			payload, err := updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				oldObject, err := json.Marshal(corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"cost-center": "finance"}}})
+				if err != nil {
+					t.Fatalf("Unexpected error: %+v", err)
+				}
+				request.OldObject = oldObject
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			// no resource is listed when no propagated label would change
+			host.Client = mocks.NewMockWapcClient(t)
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if _, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, NO_MUTATION); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
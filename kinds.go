@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+var (
+	DEPLOYMENT_KIND            = kubewarden_protocol.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	REPLICASET_KIND            = kubewarden_protocol.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}
+	STATEFULSET_KIND           = kubewarden_protocol.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}
+	DAEMONSET_KIND             = kubewarden_protocol.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}
+	REPLICATIONCONTROLLER_KIND = kubewarden_protocol.GroupVersionKind{Group: "", Version: "v1", Kind: "ReplicationController"}
+	CRONJOB_KIND               = kubewarden_protocol.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}
+	JOB_KIND                   = kubewarden_protocol.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+	POD_KIND                   = kubewarden_protocol.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"}
+	PERSISTENTVOLUME_KIND      = kubewarden_protocol.GroupVersionKind{Group: "", Version: "v1", Kind: "PersistentVolume"}
+	NAMESPACE_KIND             = kubewarden_protocol.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}
+)
+
+// supportedKinds lists the kinds handled by the policy, in the order used
+// when reporting them to the user.
+var supportedKinds = []kubewarden_protocol.GroupVersionKind{
+	POD_KIND,
+	REPLICATIONCONTROLLER_KIND,
+	DEPLOYMENT_KIND,
+	REPLICASET_KIND,
+	STATEFULSET_KIND,
+	DAEMONSET_KIND,
+	JOB_KIND,
+	CRONJOB_KIND,
+	PERSISTENTVOLUME_KIND,
+	NAMESPACE_KIND,
+}
+
+// metadataPaths defines, for each supported kind, the paths to the metadata
+// objects that must contain the propagated labels. The first path is always
+// the metadata of the object itself, the others point to the templates of
+// the pods created by the object.
+var metadataPaths = map[kubewarden_protocol.GroupVersionKind][][]string{
+	DEPLOYMENT_KIND:            {{"metadata"}, {"spec", "template", "metadata"}},
+	REPLICASET_KIND:            {{"metadata"}, {"spec", "template", "metadata"}},
+	STATEFULSET_KIND:           {{"metadata"}, {"spec", "template", "metadata"}},
+	DAEMONSET_KIND:             {{"metadata"}, {"spec", "template", "metadata"}},
+	REPLICATIONCONTROLLER_KIND: {{"metadata"}, {"spec", "template", "metadata"}},
+	CRONJOB_KIND:               {{"metadata"}, {"spec", "jobTemplate", "spec", "template", "metadata"}},
+	JOB_KIND:                   {{"metadata"}, {"spec", "template", "metadata"}},
+	POD_KIND:                   {{"metadata"}},
+	PERSISTENTVOLUME_KIND:      {{"metadata"}},
+	NAMESPACE_KIND:             {{"metadata"}},
+}
+
+// podSpecPaths defines, for each supported kind, the path to the spec of
+// the pods created by the object.
+var podSpecPaths = map[kubewarden_protocol.GroupVersionKind][]string{
+	DEPLOYMENT_KIND:            {"spec", "template", "spec"},
+	REPLICASET_KIND:            {"spec", "template", "spec"},
+	STATEFULSET_KIND:           {"spec", "template", "spec"},
+	DAEMONSET_KIND:             {"spec", "template", "spec"},
+	REPLICATIONCONTROLLER_KIND: {"spec", "template", "spec"},
+	CRONJOB_KIND:               {"spec", "jobTemplate", "spec", "template", "spec"},
+	JOB_KIND:                   {"spec", "template", "spec"},
+	POD_KIND:                   {"spec"},
+}
+
+// formatGVK returns the `group/version Kind` representation of the given
+// kind, the group is omitted for the core API group.
+func formatGVK(gvk kubewarden_protocol.GroupVersionKind) string {
+	if gvk.Group == "" {
+		return fmt.Sprintf("%s %s", gvk.Version, gvk.Kind)
+	}
+	return fmt.Sprintf("%s/%s %s", gvk.Group, gvk.Version, gvk.Kind)
+}
+
+// requestGVK returns the kind of the object sent inside of the admission
+// request. The object is always serialized using `Kind`, which can differ
+// from `RequestKind` when the API server converted the original request to
+// the version the policy registered for. `RequestKind` is used only when
+// `Kind` is not provided.
+func requestGVK(request kubewarden_protocol.KubernetesAdmissionRequest) kubewarden_protocol.GroupVersionKind {
+	if request.Kind.Kind == "" {
+		return request.RequestKind
+	}
+	if request.RequestKind.Kind != "" && request.RequestKind != request.Kind {
+		logger.DebugWith("request has been converted").
+			String("requestKind", formatGVK(request.RequestKind)).
+			String("kind", formatGVK(request.Kind)).
+			Write()
+	}
+	return request.Kind
+}
+
+// unsupportedKindError returns the error reported when the policy receives a
+// kind it cannot handle.
+func unsupportedKindError(gvk kubewarden_protocol.GroupVersionKind) error {
+	supported := make([]string, 0, len(supportedKinds))
+	for _, kind := range supportedKinds {
+		supported = append(supported, formatGVK(kind))
+	}
+	return fmt.Errorf("object should be one of these kinds: %s. Found %s", strings.Join(supported, ", "), formatGVK(gvk))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	LABEL_NAME_MAX_LENGTH   = 63
+	LABEL_PREFIX_MAX_LENGTH = 253
+	LABEL_VALUE_MAX_LENGTH  = 63
+)
+
+var (
+	// labelNameRegexp matches the name segment of a label key, and the label
+	// values. Values can also be empty.
+	labelNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	// dnsSubdomainRegexp matches the optional prefix of a label key.
+	dnsSubdomainRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// validateLabelKey checks the given string is a valid label key, made by an
+// optional DNS subdomain prefix and a name.
+func validateLabelKey(key string) error {
+	name := key
+	if prefix, suffix, hasPrefix := strings.Cut(key, "/"); hasPrefix {
+		if len(prefix) == 0 || len(prefix) > LABEL_PREFIX_MAX_LENGTH || !dnsSubdomainRegexp.MatchString(prefix) {
+			return fmt.Errorf("label key %q has an invalid prefix", key)
+		}
+		name = suffix
+	}
+	if len(name) == 0 || len(name) > LABEL_NAME_MAX_LENGTH || !labelNameRegexp.MatchString(name) {
+		return fmt.Errorf("label key %q has an invalid name", key)
+	}
+	return nil
+}
+
+// validateLabelValue checks the given string is a valid label value.
+func validateLabelValue(value string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	if len(value) > LABEL_VALUE_MAX_LENGTH || !labelNameRegexp.MatchString(value) {
+		return fmt.Errorf("label value %q is not valid", value)
+	}
+	return nil
+}
+
+// sanitizeLabelValue turns the given string into a valid label value: the
+// invalid characters are replaced by `-`, the value is truncated to the
+// maximum length, and it is trimmed to start and end with an alphanumeric
+// character.
+func sanitizeLabelValue(value string) string {
+	sanitized := []byte(value)
+	for i, char := range sanitized {
+		if !isLabelValueChar(char) {
+			sanitized[i] = '-'
+		}
+	}
+	if len(sanitized) > LABEL_VALUE_MAX_LENGTH {
+		sanitized = sanitized[:LABEL_VALUE_MAX_LENGTH]
+	}
+	return strings.TrimFunc(string(sanitized), func(char rune) bool {
+		return !isAlphanumeric(byte(char))
+	})
+}
+
+func isAlphanumeric(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
+
+func isLabelValueChar(char byte) bool {
+	return isAlphanumeric(char) || char == '-' || char == '_' || char == '.'
+}
+
+// mergeMissingLabels adds to `labels` the labels of `candidates` that are
+// not already defined. Hence, the values already in `labels` take precedence.
+func mergeMissingLabels(labels, candidates map[string]string) {
+	for label, value := range candidates {
+		if _, found := labels[label]; !found {
+			labels[label] = value
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestValidateLabelKey(t *testing.T) {
+	cases := []struct {
+		key   string
+		valid bool
+	}{
+		{"cost-center", true},
+		{"field.cattle.io/projectId", true},
+		{"example.com/team_name.v2", true},
+		{"", false},
+		{"-cost-center", false},
+		{"Example.com/team", false},
+		{"example.com/", false},
+		{"/team", false},
+		{"a/b/c", false},
+		{"this-label-name-is-way-too-long-to-be-accepted-by-the-kubernetes-api", false},
+	}
+
+	for _, tc := range cases {
+		err := validateLabelKey(tc.key)
+		if (err == nil) != tc.valid {
+			t.Errorf("Label key %q: expected valid to be %t, error: %v", tc.key, tc.valid, err)
+		}
+	}
+}
+
+func TestValidateLabelValue(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"finance", true},
+		{"team_1.eu-west", true},
+		{"TODO", true},
+		{"not valid", false},
+		{"-finance", false},
+		{"finance/team", false},
+		{"this-label-value-is-way-too-long-to-be-accepted-by-the-kubernetes-api", false},
+	}
+
+	for _, tc := range cases {
+		err := validateLabelValue(tc.value)
+		if (err == nil) != tc.valid {
+			t.Errorf("Label value %q: expected valid to be %t, error: %v", tc.value, tc.valid, err)
+		}
+	}
+}
+
+func TestSanitizeLabelValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected string
+	}{
+		{"finance", "finance"},
+		{"Finance & Accounting", "Finance---Accounting"},
+		{"  team alpha  ", "team-alpha"},
+		{"_internal_", "internal"},
+		{"équipe", "quipe"},
+		{"this value is way too long to be used as a label value by kubernetes!", "this-value-is-way-too-long-to-be-used-as-a-label-value-by-kuber"},
+		{"!!!", ""},
+	}
+
+	for _, tc := range cases {
+		sanitized := sanitizeLabelValue(tc.value)
+		if sanitized != tc.expected {
+			t.Errorf("Value %q: expected %q, found %q", tc.value, tc.expected, sanitized)
+		}
+		if err := validateLabelValue(sanitized); err != nil {
+			t.Errorf("Sanitized value %q is not valid: %v", sanitized, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const INVALID_VALUE_DEFAULT = "default"
+
+// LabelValueConstraint restricts the values of a label to either a list of
+// allowed values or the ones matching a regular expression.
+type LabelValueConstraint struct {
+	Label  string   `json:"label"`
+	Values []string `json:"values,omitempty"`
+	// Pattern is a regular expression that must match the whole value.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+func (c *LabelValueConstraint) Valid() error {
+	if err := validateLabelKey(c.Label); err != nil {
+		return err
+	}
+	if (len(c.Values) == 0) == (c.Pattern == "") {
+		return fmt.Errorf("label %s requires either values or pattern", c.Label)
+	}
+	for _, value := range c.Values {
+		if err := validateLabelValue(value); err != nil {
+			return fmt.Errorf("label %s: %w", c.Label, err)
+		}
+	}
+	if _, err := c.pattern(); err != nil {
+		return fmt.Errorf("label %s has an invalid pattern: %w", c.Label, err)
+	}
+	return nil
+}
+
+// pattern compiles the regular expression of the constraint, anchored to
+// match the whole value. Returns nil when no pattern is defined.
+func (c *LabelValueConstraint) pattern() (*regexp.Regexp, error) {
+	if c.Pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + c.Pattern + ")$")
+}
+
+// check returns an error describing why the given value is not allowed.
+func (c *LabelValueConstraint) check(value string) error {
+	if len(c.Values) > 0 {
+		if slices.Contains(c.Values, value) {
+			return nil
+		}
+		return fmt.Errorf("label %s value %q is not allowed, allowed values are: %s", c.Label, value, strings.Join(c.Values, ", "))
+	}
+	pattern, err := c.pattern()
+	if err != nil {
+		return err
+	}
+	if !pattern.MatchString(value) {
+		return fmt.Errorf("label %s value %q does not match the pattern %q", c.Label, value, c.Pattern)
+	}
+	return nil
+}
+
+// findLabelValueConstraint returns the constraint defined for the given
+// label, or nil when the label is not constrained.
+func findLabelValueConstraint(constraints []LabelValueConstraint, label string) *LabelValueConstraint {
+	for i := range constraints {
+		if constraints[i].Label == label {
+			return &constraints[i]
+		}
+	}
+	return nil
+}
+
+// LabelValueSettings restricts the values of a propagated label. OnInvalid
+// defines what to do when the value is not allowed: `skip` (default) the
+// label, use the `default` value or `reject` the request.
+type LabelValueSettings struct {
+	LabelValueConstraint
+	OnInvalid string `json:"onInvalid,omitempty"`
+	Default   string `json:"default,omitempty"`
+}
+
+func (l *LabelValueSettings) Valid() error {
+	if err := l.LabelValueConstraint.Valid(); err != nil {
+		return fmt.Errorf("labelValues: %w", err)
+	}
+	switch l.OnInvalid {
+	case "", INVALID_VALUE_SKIP, INVALID_VALUE_REJECT:
+	case INVALID_VALUE_DEFAULT:
+		if l.Default == "" {
+			return fmt.Errorf("labelValues label %s requires a default value", l.Label)
+		}
+		if err := l.check(l.Default); err != nil {
+			return fmt.Errorf("labelValues default value: %w", err)
+		}
+	default:
+		return fmt.Errorf("labelValues label %s: onInvalid must be one of %q, %q or %q", l.Label, INVALID_VALUE_SKIP, INVALID_VALUE_DEFAULT, INVALID_VALUE_REJECT)
+	}
+	if l.Default != "" && l.OnInvalid != INVALID_VALUE_DEFAULT {
+		return fmt.Errorf("labelValues label %s: default is allowed only when onInvalid is %q", l.Label, INVALID_VALUE_DEFAULT)
+	}
+	return nil
+}
+
+// applyLabelValues checks the values of the labels to propagate against the
+// `labelValues` settings. The values that are not allowed are removed or
+// replaced by the default value, an error is returned when the request must
+// be rejected. Every decision is logged.
+func applyLabelValues(labelsToPropagate map[string]string, request kubewarden_protocol.KubernetesAdmissionRequest, settings Settings) (map[string]string, error) {
+	for _, rule := range settings.LabelValues {
+		value, found := labelsToPropagate[rule.Label]
+		if !found {
+			continue
+		}
+		err := rule.check(value)
+		if err == nil {
+			continue
+		}
+
+		action := rule.OnInvalid
+		if action == "" {
+			action = INVALID_VALUE_SKIP
+		}
+		logger.WarnWith("propagated label value is not allowed").
+			String("uid", request.Uid).
+			String("namespace", request.Namespace).
+			String("label", rule.Label).
+			String("value", value).
+			String("action", action).
+			Write()
+
+		switch action {
+		case INVALID_VALUE_REJECT:
+			return nil, &rejectionError{Code: 400, Err: fmt.Errorf("namespace %s: %w", request.Namespace, err)}
+		case INVALID_VALUE_DEFAULT:
+			labelsToPropagate[rule.Label] = rule.Default
+		default:
+			delete(labelsToPropagate, rule.Label)
+		}
+	}
+	return labelsToPropagate, nil
+}
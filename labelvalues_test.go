@@ -0,0 +1,228 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+func TestLabelValueConstraint(t *testing.T) {
+	cases := []struct {
+		name       string
+		constraint LabelValueConstraint
+		value      string
+		allowed    bool
+	}{
+		{"allowed value", LabelValueConstraint{Label: "cost-center", Values: []string{"finance", "engineering"}}, "finance", true},
+		{"value not allowed", LabelValueConstraint{Label: "cost-center", Values: []string{"finance", "engineering"}}, "TODO", false},
+		{"matching pattern", LabelValueConstraint{Label: "team", Pattern: "team-[a-z]+"}, "team-a", true},
+		{"partial match", LabelValueConstraint{Label: "team", Pattern: "team-[a-z]+"}, "team-a1", false},
+		{"alternatives are anchored", LabelValueConstraint{Label: "team", Pattern: "a|b"}, "ab", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.constraint.check(tc.value)
+			if (err == nil) != tc.allowed {
+				t.Errorf("Expected allowed to be %t, error: %v", tc.allowed, err)
+			}
+		})
+	}
+}
+
+func TestLabelValueConstraintValidation(t *testing.T) {
+	cases := []struct {
+		name       string
+		constraint LabelValueConstraint
+		valid      bool
+	}{
+		{"values", LabelValueConstraint{Label: "cost-center", Values: []string{"finance"}}, true},
+		{"pattern", LabelValueConstraint{Label: "team", Pattern: "team-[a-z]+"}, true},
+		{"invalid label", LabelValueConstraint{Label: "not a label", Values: []string{"finance"}}, false},
+		{"neither values nor pattern", LabelValueConstraint{Label: "team"}, false},
+		{"both values and pattern", LabelValueConstraint{Label: "team", Values: []string{"a"}, Pattern: "a"}, false},
+		{"invalid value", LabelValueConstraint{Label: "team", Values: []string{"team a"}}, false},
+		{"invalid pattern", LabelValueConstraint{Label: "team", Pattern: "team-("}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.constraint.Valid()
+			if (err == nil) != tc.valid {
+				t.Errorf("Expected valid to be %t, error: %v", tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestLabelValuesArePropagated(t *testing.T) {
+	cases := []struct {
+		name           string
+		rule           LabelValueSettings
+		accept         bool
+		expectedLabels map[string]string
+	}{
+		{
+			"allowed value",
+			LabelValueSettings{LabelValueConstraint: LabelValueConstraint{Label: "cost-center", Values: []string{"TODO"}}},
+			SHOULD_ACCEPT,
+			map[string]string{"cost-center": "TODO", "team": "a"},
+		},
+		{
+			"invalid value skipped",
+			LabelValueSettings{LabelValueConstraint: LabelValueConstraint{Label: "cost-center", Values: []string{"finance"}}},
+			SHOULD_ACCEPT,
+			map[string]string{"team": "a"},
+		},
+		{
+			"invalid value replaced by default",
+			LabelValueSettings{LabelValueConstraint: LabelValueConstraint{Label: "cost-center", Pattern: "[a-z]+"}, OnInvalid: INVALID_VALUE_DEFAULT, Default: "unassigned"},
+			SHOULD_ACCEPT,
+			map[string]string{"cost-center": "unassigned", "team": "a"},
+		},
+		{
+			"invalid value rejected",
+			LabelValueSettings{LabelValueConstraint: LabelValueConstraint{Label: "cost-center", Values: []string{"finance"}}, OnInvalid: INVALID_VALUE_REJECT},
+			SHOULD_REJECT,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+			payload, err := buildValidationRequest([]string{"cost-center", "team"}, resource, POD_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.LabelValues = []LabelValueSettings{tc.rule}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			mockNamespaceLabels(t, map[string]string{"cost-center": "TODO", "team": "a"})
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !tc.accept {
+				response, err := basicResposeValidation(responsePayload, SHOULD_REJECT, NO_MUTATION)
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				if *response.Code != 400 {
+					t.Errorf("Expected code 400, found %d", *response.Code)
+				}
+				return
+			}
+			labels, err := mutatedPodLabels(responsePayload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestLabelValuesRestrictWorkloadOverrides(t *testing.T) {
+	cases := []struct {
+		name           string
+		override       string
+		onInvalid      string
+		accept         bool
+		expectedLabels map[string]string
+	}{
+		{"allowed override", "cost-center=engineering", INVALID_VALUE_REJECT, SHOULD_ACCEPT, map[string]string{"cost-center": "engineering"}},
+		{"invalid override replaced by default", "cost-center=TODO", INVALID_VALUE_DEFAULT, SHOULD_ACCEPT, map[string]string{"cost-center": "unassigned"}},
+		{"invalid override rejected", "cost-center=TODO", INVALID_VALUE_REJECT, SHOULD_REJECT, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource := corev1.Pod{Metadata: &metav1.ObjectMeta{
+				Name:        "test",
+				Namespace:   TEST_NAMESPACE,
+				Annotations: map[string]string{OVERRIDE_ANNOTATION: tc.override},
+			}}
+			payload, err := buildValidationRequest([]string{"cost-center"}, resource, POD_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.WorkloadOverrides = &testWorkloadOverrides
+				settings.LabelValues = []LabelValueSettings{{
+					LabelValueConstraint: LabelValueConstraint{Label: "cost-center", Values: []string{"finance", "engineering"}},
+					OnInvalid:            tc.onInvalid,
+					Default:              "unassigned",
+				}}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				request.UserInfo = kubewarden_protocol.UserInfo{Username: "alice"}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			wapcClient := mockNamespaceLabels(t, map[string]string{"cost-center": "finance"})
+			mockCanI(t, wapcClient, overridesPermission, "alice", true, nil)
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !tc.accept {
+				response, err := basicResposeValidation(responsePayload, SHOULD_REJECT, NO_MUTATION)
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				if *response.Code != 400 {
+					t.Errorf("Expected code 400, found %d", *response.Code)
+				}
+				return
+			}
+			labels, err := mutatedPodLabels(responsePayload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestLabelValuesSettingsValidation(t *testing.T) {
+	constraint := LabelValueConstraint{Label: "cost-center", Values: []string{"finance", "unassigned"}}
+	cases := []struct {
+		name  string
+		rules []LabelValueSettings
+		valid bool
+	}{
+		{"skip by default", []LabelValueSettings{{LabelValueConstraint: constraint}}, true},
+		{"valid default", []LabelValueSettings{{LabelValueConstraint: constraint, OnInvalid: INVALID_VALUE_DEFAULT, Default: "unassigned"}}, true},
+		{"missing default", []LabelValueSettings{{LabelValueConstraint: constraint, OnInvalid: INVALID_VALUE_DEFAULT}}, false},
+		{"default not allowed", []LabelValueSettings{{LabelValueConstraint: constraint, OnInvalid: INVALID_VALUE_DEFAULT, Default: "TODO"}}, false},
+		{"default without onInvalid", []LabelValueSettings{{LabelValueConstraint: constraint, Default: "unassigned"}}, false},
+		{"invalid onInvalid", []LabelValueSettings{{LabelValueConstraint: constraint, OnInvalid: "drop"}}, false},
+		{"invalid constraint", []LabelValueSettings{{LabelValueConstraint: LabelValueConstraint{Label: "cost-center"}}}, false},
+		{"label defined twice", []LabelValueSettings{{LabelValueConstraint: constraint}, {LabelValueConstraint: constraint}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, LabelValues: tc.rules}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
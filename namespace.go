@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+func getNamespace(validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (*corev1.Namespace, error) {
+	if len(validationRequest.Request.Namespace) == 0 {
+		return nil, fmt.Errorf("admission request is missing namespace")
+	}
+	return fetchNamespace(validationRequest.Request.Namespace, settings.cacheDisabled(validationRequest.Request.Operation))
+}
+
+// fetchNamespace gets the namespace with the given name using the host
+// capabilities.
+func fetchNamespace(name string, disableCache bool) (*corev1.Namespace, error) {
+	namespace := &corev1.Namespace{}
+	if err := fetchResource("v1", "Namespace", name, nil, disableCache, namespace); err != nil {
+		return nil, err
+	}
+	if namespace.Metadata == nil {
+		return nil, &lookupError{Reason: LOOKUP_INVALID, Err: errors.New("cannot parse namespace data: metadata is missing")}
+	}
+	return namespace, nil
+}
+
+// parentNamespaceName returns the name of the parent of the given namespace,
+// as defined by the hierarchy settings. An empty string is returned for the
+// root namespaces.
+func parentNamespaceName(namespace *corev1.Namespace, hierarchy *NamespaceHierarchySettings) string {
+	if hierarchy.Annotation != "" {
+		return namespace.Metadata.Annotations[hierarchy.Annotation]
+	}
+	return namespace.Metadata.Labels[hierarchy.Label]
+}
+
+// namespaceLabels returns the labels of the given namespace. When the
+// namespace hierarchy is enabled, the labels of its ancestors are merged too:
+// the labels of the nearest namespace win. The walk stops at the root of the
+// hierarchy, at the maximum depth, on cycles and on missing parents.
+func namespaceLabels(namespace *corev1.Namespace, validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	labels := make(map[string]string, len(namespace.Metadata.Labels))
+	for label, value := range namespace.Metadata.Labels {
+		labels[label] = value
+	}
+
+	hierarchy := settings.NamespaceHierarchy
+	if hierarchy == nil {
+		return labels, nil
+	}
+
+	visited := map[string]bool{namespace.Metadata.Name: true}
+	current := namespace
+	for depth := 1; depth <= hierarchy.maxDepth(); depth++ {
+		parentName := parentNamespaceName(current, hierarchy)
+		if parentName == "" {
+			return labels, nil
+		}
+		if visited[parentName] {
+			logger.WarnWith("cycle detected in the namespace hierarchy").
+				String("uid", validationRequest.Request.Uid).
+				String("namespace", validationRequest.Request.Namespace).
+				String("parent", parentName).
+				Write()
+			return labels, nil
+		}
+		visited[parentName] = true
+
+		parent, err := fetchNamespace(parentName, settings.cacheDisabled(validationRequest.Request.Operation))
+		if err != nil {
+			if isLookupNotFound(err) {
+				logger.WarnWith("parent namespace not found").
+					String("uid", validationRequest.Request.Uid).
+					String("namespace", validationRequest.Request.Namespace).
+					String("parent", parentName).
+					Write()
+				return labels, nil
+			}
+			return nil, err
+		}
+		mergeMissingLabels(labels, parent.Metadata.Labels)
+		current = parent
+	}
+
+	if parentNamespaceName(current, hierarchy) != "" {
+		logger.DebugWith("maximum depth of the namespace hierarchy reached").
+			String("namespace", validationRequest.Request.Namespace).
+			Int("maxDepth", hierarchy.maxDepth()).
+			Write()
+	}
+	return labels, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// mockNamespaceLookup configures the host to answer the lookup of the test
+// namespace with the given payload and error. The returned client can be
+// used to mock other host calls.
+func mockNamespaceLookup(t *testing.T, disableCache bool, response []byte, err error) *mocks.MockWapcClient {
+	wapcRequest, marshalErr := json.Marshal(&kubernetes.GetResourceRequest{
+		APIVersion:   "v1",
+		Kind:         "Namespace",
+		Name:         TEST_NAMESPACE,
+		DisableCache: disableCache,
+	})
+	if marshalErr != nil {
+		t.Fatalf("Cannot create wapcRequest payload: %+v", marshalErr)
+	}
+
+	wapcClient := mocks.NewMockWapcClient(t)
+	wapcClient.On("HostCall", "kubewarden", "kubernetes", "get_resource", wapcRequest).Return(response, err)
+	host.Client = wapcClient
+	return wapcClient
+}
+
+// mockNamespaceLabels configures the host to answer the lookup of the test
+// namespace with a namespace having the given labels.
+func mockNamespaceLabels(t *testing.T, labels map[string]string) *mocks.MockWapcClient {
+	response, err := json.Marshal(&corev1.Namespace{
+		Metadata: &metav1.ObjectMeta{Name: TEST_NAMESPACE, Labels: labels},
+	})
+	if err != nil {
+		t.Fatalf("Cannot create wapcResponse payload: %+v", err)
+	}
+	return mockNamespaceLookup(t, false, response, nil)
+}
+
+func TestNamespaceLookupFailures(t *testing.T) {
+	notFoundErr := errors.New(`namespaces "default" not found: NotFound`)
+	transientErr := errors.New("error sending request: connection refused")
+	unknownResourceErr := errors.New("the server could not find the requested resource: NotFound")
+	routeNotFoundErr := errors.New("route not found")
+
+	cases := []struct {
+		name          string
+		failurePolicy string
+		response      []byte
+		err           error
+		accept        bool
+		code          uint16
+	}{
+		{"not found rejected by default", "", []byte{}, notFoundErr, SHOULD_REJECT, 404},
+		{"not found rejected", FAILURE_POLICY_FAIL_CLOSED, []byte{}, notFoundErr, SHOULD_REJECT, 404},
+		{"transient error rejected", FAILURE_POLICY_FAIL_CLOSED, []byte{}, transientErr, SHOULD_REJECT, 503},
+		{"unknown resource rejected as unavailable", FAILURE_POLICY_FAIL_CLOSED, []byte{}, unknownResourceErr, SHOULD_REJECT, 503},
+		{"unrelated not found rejected as unavailable", FAILURE_POLICY_FAIL_CLOSED, []byte{}, routeNotFoundErr, SHOULD_REJECT, 503},
+		{"invalid namespace rejected", FAILURE_POLICY_FAIL_CLOSED, []byte(`{"metadata": "invalid"}`), nil, SHOULD_REJECT, 500},
+		{"namespace without metadata rejected", FAILURE_POLICY_FAIL_CLOSED, []byte(`{}`), nil, SHOULD_REJECT, 500},
+		{"not found accepted", FAILURE_POLICY_FAIL_OPEN, []byte{}, notFoundErr, SHOULD_ACCEPT, 0},
+		{"transient error accepted", FAILURE_POLICY_FAIL_OPEN, []byte{}, transientErr, SHOULD_ACCEPT, 0},
+		{"invalid namespace accepted", FAILURE_POLICY_FAIL_OPEN, []byte(`{"metadata": "invalid"}`), nil, SHOULD_ACCEPT, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+			payload, err := buildValidationRequest([]string{"testing"}, resource, POD_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.FailurePolicy = tc.failurePolicy
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			mockNamespaceLookup(t, false, tc.response, tc.err)
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, tc.accept, NO_MUTATION)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if response.MutatedObject != nil {
+				t.Errorf("Request should not be mutated")
+			}
+			if !tc.accept && *response.Code != tc.code {
+				t.Errorf("Expected code %d, found %d", tc.code, *response.Code)
+			}
+		})
+	}
+}
+
+func TestNamespaceLookupCache(t *testing.T) {
+	cases := []struct {
+		name                   string
+		disableCache           bool
+		disableCacheOperations []string
+		operation              string
+		expectDisabledCache    bool
+	}{
+		{"cache enabled by default", false, nil, "CREATE", false},
+		{"cache disabled", true, nil, "UPDATE", true},
+		{"cache disabled on CREATE", false, []string{"CREATE"}, "CREATE", true},
+		{"cache enabled on UPDATE", false, []string{"CREATE"}, "UPDATE", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{
+				PropagatedLabels:       []string{"testing"},
+				DisableCache:           tc.disableCache,
+				DisableCacheOperations: tc.disableCacheOperations,
+			}
+			validationRequest := kubewarden_protocol.ValidationRequest{}
+			validationRequest.Request.Namespace = TEST_NAMESPACE
+			validationRequest.Request.Operation = tc.operation
+
+			namespaceResponse, err := json.Marshal(&corev1.Namespace{
+				Metadata: &metav1.ObjectMeta{Name: TEST_NAMESPACE},
+			})
+			if err != nil {
+				t.Fatalf("Cannot create wapcResponse payload: %+v", err)
+			}
+			mockNamespaceLookup(t, tc.expectDisabledCache, namespaceResponse, nil)
+
+			if _, err := getNamespace(validationRequest, settings); err != nil {
+				t.Errorf("Unexpected error: %+v", err)
+			}
+		})
+	}
+}
+
+// mockGetResource configures the given client to answer the given
+// `get_resource` request.
+func mockGetResource(t *testing.T, wapcClient *mocks.MockWapcClient, request kubernetes.GetResourceRequest, response interface{}, err error) {
+	wapcRequest, marshalErr := json.Marshal(&request)
+	if marshalErr != nil {
+		t.Fatalf("Cannot create wapcRequest payload: %+v", marshalErr)
+	}
+	wapcResponse := []byte{}
+	if response != nil {
+		wapcResponse, marshalErr = json.Marshal(response)
+		if marshalErr != nil {
+			t.Fatalf("Cannot create wapcResponse payload: %+v", marshalErr)
+		}
+	}
+	wapcClient.On("HostCall", "kubewarden", "kubernetes", "get_resource", wapcRequest).Return(wapcResponse, err)
+}
+
+// mockNamespaces configures the given client to answer the lookup of the
+// given namespaces. Namespaces without a definition are reported as missing.
+func mockNamespaces(t *testing.T, wapcClient *mocks.MockWapcClient, namespaces map[string]*corev1.Namespace) {
+	for name, namespace := range namespaces {
+		request := kubernetes.GetResourceRequest{APIVersion: "v1", Kind: "Namespace", Name: name}
+		if namespace == nil {
+			mockGetResource(t, wapcClient, request, nil, errors.New(`namespaces "`+name+`" not found: NotFound`))
+			continue
+		}
+		mockGetResource(t, wapcClient, request, namespace, nil)
+	}
+}
+
+// childNamespace returns a namespace with the given labels, whose parent is
+// defined by the HNC annotation.
+func childNamespace(name, parent string, labels map[string]string) *corev1.Namespace {
+	annotations := map[string]string{}
+	if parent != "" {
+		annotations["hnc.x-k8s.io/subnamespace-of"] = parent
+	}
+	return &corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+}
+
+func TestNamespaceHierarchy(t *testing.T) {
+	cases := []struct {
+		name           string
+		maxDepth       int
+		namespace      *corev1.Namespace
+		ancestors      map[string]*corev1.Namespace
+		expectedLabels map[string]string
+	}{
+		{
+			"nearest ancestor wins",
+			0,
+			childNamespace("team-a-dev", "team-a", map[string]string{"env": "dev"}),
+			map[string]*corev1.Namespace{
+				"team-a":        childNamespace("team-a", "business-unit", map[string]string{"team": "a", "cost-center": "team-a"}),
+				"business-unit": childNamespace("business-unit", "", map[string]string{"business-unit": "retail", "cost-center": "retail"}),
+			},
+			map[string]string{"env": "dev", "team": "a", "cost-center": "team-a", "business-unit": "retail"},
+		},
+		{
+			"max depth",
+			1,
+			childNamespace("team-a-dev", "team-a", map[string]string{"env": "dev"}),
+			map[string]*corev1.Namespace{
+				"team-a": childNamespace("team-a", "business-unit", map[string]string{"team": "a"}),
+			},
+			map[string]string{"env": "dev", "team": "a"},
+		},
+		{
+			"cycle",
+			0,
+			childNamespace("team-a-dev", "team-a", map[string]string{"env": "dev"}),
+			map[string]*corev1.Namespace{
+				"team-a": childNamespace("team-a", "team-a-dev", map[string]string{"team": "a"}),
+			},
+			map[string]string{"env": "dev", "team": "a"},
+		},
+		{
+			"missing parent",
+			0,
+			childNamespace("team-a-dev", "team-a", map[string]string{"env": "dev"}),
+			map[string]*corev1.Namespace{
+				"team-a": nil,
+			},
+			map[string]string{"env": "dev"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{
+				PropagatedLabels:   []string{"cost-center"},
+				NamespaceHierarchy: &NamespaceHierarchySettings{Annotation: "hnc.x-k8s.io/subnamespace-of", MaxDepth: tc.maxDepth},
+			}
+			validationRequest := kubewarden_protocol.ValidationRequest{}
+			validationRequest.Request.Namespace = tc.namespace.Metadata.Name
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			mockNamespaces(t, wapcClient, tc.ancestors)
+			host.Client = wapcClient
+
+			labels, err := namespaceLabels(tc.namespace, validationRequest, settings)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestNamespaceHierarchyParentLookupFailure(t *testing.T) {
+	resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+	payload, err := buildValidationRequest([]string{"cost-center"}, resource, POD_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.NamespaceHierarchy = &NamespaceHierarchySettings{Label: "parent"}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	wapcClient := mockNamespaceLabels(t, map[string]string{"parent": "root"})
+	mockGetResource(t, wapcClient, kubernetes.GetResourceRequest{APIVersion: "v1", Kind: "Namespace", Name: "root"}, nil, errors.New("connection refused"))
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_REJECT, NO_MUTATION)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if *response.Code != 503 {
+		t.Errorf("Expected code 503, found %d", *response.Code)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	kubewarden "github.com/kubewarden/policy-sdk-go"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// NamespaceDefaultsSettings defines the labels set on the namespaces when
+// they are created, unless they already define them.
+type NamespaceDefaultsSettings struct {
+	// Labels defines the default labels, and their values.
+	Labels map[string]string `json:"labels,omitempty"`
+	// TemplateNamespace is the namespace whose propagated labels are copied
+	// to the new namespaces. Its values win over the ones of `labels`.
+	TemplateNamespace string `json:"templateNamespace,omitempty"`
+}
+
+func (n *NamespaceDefaultsSettings) Valid() error {
+	if len(n.Labels) == 0 && n.TemplateNamespace == "" {
+		return errors.New("namespaceDefaults requires either labels or templateNamespace")
+	}
+	keys := make([]string, 0, len(n.Labels))
+	for key := range n.Labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if err := validateLabelKey(key); err != nil {
+			return fmt.Errorf("namespaceDefaults labels: %w", err)
+		}
+		if err := validateLabelValue(n.Labels[key]); err != nil {
+			return fmt.Errorf("namespaceDefaults labels %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// NamespaceValidationSettings defines the labels the namespaces must have,
+// and the values allowed for them.
+type NamespaceValidationSettings struct {
+	// Required lists the labels every namespace must define.
+	Required []string               `json:"required,omitempty"`
+	Labels   []LabelValueConstraint `json:"labels,omitempty"`
+}
+
+func (n *NamespaceValidationSettings) Valid() error {
+	if len(n.Required) == 0 && len(n.Labels) == 0 {
+		return errors.New("namespaceValidation requires either required or labels")
+	}
+	for _, label := range n.Required {
+		if err := validateLabelKey(label); err != nil {
+			return fmt.Errorf("namespaceValidation required: %w", err)
+		}
+	}
+	for i, constraint := range n.Labels {
+		if err := constraint.Valid(); err != nil {
+			return fmt.Errorf("namespaceValidation: %w", err)
+		}
+		if findLabelValueConstraint(n.Labels[:i], constraint.Label) != nil {
+			return fmt.Errorf("namespaceValidation: label %s is defined more than once", constraint.Label)
+		}
+	}
+	return nil
+}
+
+// violations returns the reasons why the given namespace labels are not
+// valid. When the old labels are given, only the labels changed by the
+// request are checked: namespaces created before the validation was enabled
+// can still be updated.
+func (n *NamespaceValidationSettings) violations(labels, oldLabels map[string]string, isUpdate bool) []string {
+	changed := func(label string) bool {
+		value, found := labels[label]
+		oldValue, oldFound := oldLabels[label]
+		return !isUpdate || found != oldFound || value != oldValue
+	}
+
+	var violations []string
+	for _, label := range n.Required {
+		if _, found := labels[label]; !found && changed(label) {
+			violations = append(violations, fmt.Sprintf("label %s is required", label))
+		}
+	}
+	for _, constraint := range n.Labels {
+		value, found := labels[constraint.Label]
+		if !found || !changed(constraint.Label) {
+			continue
+		}
+		if err := constraint.check(value); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+	return violations
+}
+
+// validateNamespace handles the requests made for the Namespaces, instead of
+// the workloads living inside of them.
+func validateNamespace(validationRequest kubewarden_protocol.ValidationRequest, settings Settings) ([]byte, error) {
+	operation := validationRequest.Request.Operation
+	if operation != "CREATE" && operation != "UPDATE" {
+		return kubewarden.AcceptRequest()
+	}
+
+	labels, err := requestNamespaceLabels(validationRequest.Request.Object)
+	if err != nil {
+		return kubewarden.RejectRequest(kubewarden.Message(err.Error()), kubewarden.Code(400))
+	}
+	var oldLabels map[string]string
+	if operation == "UPDATE" {
+		oldLabels, err = requestNamespaceLabels(validationRequest.Request.OldObject)
+		if err != nil {
+			return kubewarden.RejectRequest(kubewarden.Message(err.Error()), kubewarden.Code(400))
+		}
+	}
+
+	if operation == "UPDATE" && settings.NamespaceProtection != nil {
+		if err := authorizeNamespaceLabelChanges(validationRequest.Request, labels, oldLabels, settings); err != nil {
+			return rejectWithError(err)
+		}
+	}
+
+	defaults := make(map[string]string)
+	if operation == "CREATE" && settings.NamespaceDefaults != nil {
+		defaults, err = namespaceDefaultLabels(labels, validationRequest, settings)
+		if err != nil {
+			return handleLookupFailure(validationRequest, settings, err)
+		}
+	}
+
+	if settings.NamespaceValidation != nil {
+		newLabels := make(map[string]string, len(labels)+len(defaults))
+		mergeMissingLabels(newLabels, labels)
+		mergeMissingLabels(newLabels, defaults)
+		if violations := settings.NamespaceValidation.violations(newLabels, oldLabels, operation == "UPDATE"); len(violations) > 0 {
+			message := fmt.Sprintf("namespace %s has invalid labels: %s", validationRequest.Request.Name, strings.Join(violations, "; "))
+			return kubewarden.RejectRequest(kubewarden.Message(message), kubewarden.Code(400))
+		}
+	}
+
+	if operation == "UPDATE" && settings.ReportNamespaceImpact {
+		reportNamespaceImpact(validationRequest.Request, labels, oldLabels, settings)
+	}
+	return updateResourceLabels(validationRequest, defaults, nil)
+}
+
+// requestNamespaceLabels returns the labels of the namespace sent inside of
+// the request.
+func requestNamespaceLabels(object json.RawMessage) (map[string]string, error) {
+	namespace := corev1.Namespace{}
+	if err := json.Unmarshal(object, &namespace); err != nil {
+		return nil, err
+	}
+	if namespace.Metadata == nil {
+		return map[string]string{}, nil
+	}
+	return namespace.Metadata.Labels, nil
+}
+
+// requestNamespaceAnnotations returns the annotations of the namespace sent
+// inside of the request.
+func requestNamespaceAnnotations(object json.RawMessage) (map[string]string, error) {
+	namespace := corev1.Namespace{}
+	if err := json.Unmarshal(object, &namespace); err != nil {
+		return nil, err
+	}
+	if namespace.Metadata == nil {
+		return map[string]string{}, nil
+	}
+	return namespace.Metadata.Annotations, nil
+}
+
+// templateNamespaceLabels returns the propagated labels defined by the
+// template namespace. A missing template namespace has no labels.
+func templateNamespaceLabels(validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	labels := make(map[string]string)
+	name := settings.NamespaceDefaults.TemplateNamespace
+	if name == "" {
+		return labels, nil
+	}
+
+	template, err := fetchNamespace(name, settings.cacheDisabled(validationRequest.Request.Operation))
+	if isLookupNotFound(err) {
+		logger.WarnWith("template namespace not found").
+			String("uid", validationRequest.Request.Uid).
+			String("templateNamespace", name).
+			Write()
+		return labels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range settings.propagatedLabelKeys() {
+		if value, found := template.Metadata.Labels[label]; found {
+			labels[label] = value
+		}
+	}
+	return labels, nil
+}
+
+// namespaceDefaultLabels returns the default labels missing from the
+// namespace labels.
+func namespaceDefaultLabels(existing map[string]string, validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	candidates, err := templateNamespaceLabels(validationRequest, settings)
+	if err != nil {
+		return nil, err
+	}
+	mergeMissingLabels(candidates, settings.NamespaceDefaults.Labels)
+
+	defaults := make(map[string]string)
+	for label, value := range candidates {
+		if _, found := existing[label]; !found {
+			defaults[label] = value
+		}
+	}
+	return defaults, nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// namespaceRequest returns the request for the given operation on a
+// namespace with the given labels.
+func namespaceRequest(t *testing.T, operation string, labels map[string]string, update func(*Settings)) []byte {
+	resource := corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: labels}}
+	payload, err := buildValidationRequest([]string{"cost-center", "team"}, resource, NAMESPACE_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, update)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+		request.Operation = operation
+		request.Name = "team-a"
+		request.Namespace = "team-a"
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	return payload
+}
+
+func TestNamespaceDefaults(t *testing.T) {
+	template := &corev1.Namespace{Metadata: &metav1.ObjectMeta{
+		Name:   "namespace-template",
+		Labels: map[string]string{"cost-center": "template", "team": "platform", "other": "ignored"},
+	}}
+
+	cases := []struct {
+		name           string
+		defaults       NamespaceDefaultsSettings
+		template       *corev1.Namespace
+		labels         map[string]string
+		expectedLabels map[string]string
+	}{
+		{
+			"labels from settings",
+			NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "unassigned"}},
+			nil,
+			nil,
+			map[string]string{"cost-center": "unassigned"},
+		},
+		{
+			"template wins over settings",
+			NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "unassigned", "tier": "standard"}, TemplateNamespace: "namespace-template"},
+			template,
+			nil,
+			map[string]string{"cost-center": "template", "team": "platform", "tier": "standard"},
+		},
+		{
+			"missing template",
+			NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "unassigned"}, TemplateNamespace: "namespace-template"},
+			nil,
+			nil,
+			map[string]string{"cost-center": "unassigned"},
+		},
+		{
+			"existing labels are kept",
+			NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "unassigned", "tier": "standard"}},
+			nil,
+			map[string]string{"cost-center": "finance"},
+			map[string]string{"cost-center": "finance", "tier": "standard"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := namespaceRequest(t, "CREATE", tc.labels, func(settings *Settings) {
+				settings.NamespaceDefaults = &tc.defaults
+			})
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			if tc.defaults.TemplateNamespace != "" {
+				mockNamespaces(t, wapcClient, map[string]*corev1.Namespace{tc.defaults.TemplateNamespace: tc.template})
+			}
+			host.Client = wapcClient
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			labels, err := mutatedPodLabels(responsePayload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestNamespaceDefaultsTemplateLookupFailure(t *testing.T) {
+	payload := namespaceRequest(t, "CREATE", nil, func(settings *Settings) {
+		settings.NamespaceDefaults = &NamespaceDefaultsSettings{TemplateNamespace: "namespace-template"}
+	})
+
+	wapcClient := mocks.NewMockWapcClient(t)
+	mockGetResource(t, wapcClient, kubernetes.GetResourceRequest{APIVersion: "v1", Kind: "Namespace", Name: "namespace-template"}, nil, errors.New("connection refused"))
+	host.Client = wapcClient
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_REJECT, NO_MUTATION)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if response.Code == nil || *response.Code != 503 {
+		t.Errorf("Expected the request to be rejected with code 503")
+	}
+}
+
+func TestNamespaceUpdateIsAccepted(t *testing.T) {
+	payload := namespaceRequest(t, "UPDATE", nil, func(settings *Settings) {
+		settings.NamespaceDefaults = &NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "unassigned"}}
+	})
+
+	// namespace updates do not need any lookup
+	host.Client = mocks.NewMockWapcClient(t)
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if _, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, NO_MUTATION); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestNamespaceDefaultsSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name     string
+		defaults NamespaceDefaultsSettings
+		valid    bool
+	}{
+		{"valid labels", NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "unassigned"}}, true},
+		{"valid template", NamespaceDefaultsSettings{TemplateNamespace: "namespace-template"}, true},
+		{"empty settings", NamespaceDefaultsSettings{}, false},
+		{"invalid key", NamespaceDefaultsSettings{Labels: map[string]string{"not a label": "unassigned"}}, false},
+		{"invalid value", NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "not assigned"}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, NamespaceDefaults: &tc.defaults}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
+
+func TestNamespaceValidation(t *testing.T) {
+	validation := &NamespaceValidationSettings{
+		Required: []string{"cost-center"},
+		Labels: []LabelValueConstraint{
+			{Label: "cost-center", Values: []string{"finance", "engineering"}},
+			{Label: "team", Pattern: "team-[a-z]+"},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		operation string
+		labels    map[string]string
+		oldLabels map[string]string
+		defaults  *NamespaceDefaultsSettings
+		accept    bool
+		message   string
+	}{
+		{"valid labels", "CREATE", map[string]string{"cost-center": "finance", "team": "team-a"}, nil, nil, SHOULD_ACCEPT, ""},
+		{"missing required label", "CREATE", map[string]string{"team": "team-a"}, nil, nil, SHOULD_REJECT, "namespace team-a has invalid labels: label cost-center is required"},
+		{
+			"invalid values",
+			"CREATE",
+			map[string]string{"cost-center": "TODO", "team": "a"},
+			nil,
+			nil,
+			SHOULD_REJECT,
+			`namespace team-a has invalid labels: label cost-center value "TODO" is not allowed, allowed values are: finance, engineering; label team value "a" does not match the pattern "team-[a-z]+"`,
+		},
+		{"required label set by default", "CREATE", nil, nil, &NamespaceDefaultsSettings{Labels: map[string]string{"cost-center": "finance"}}, SHOULD_ACCEPT, ""},
+		{"legacy value unchanged", "UPDATE", map[string]string{"cost-center": "TODO", "team": "team-a"}, map[string]string{"cost-center": "TODO"}, nil, SHOULD_ACCEPT, ""},
+		{"legacy namespace without required label", "UPDATE", map[string]string{"team": "team-a"}, map[string]string{}, nil, SHOULD_ACCEPT, ""},
+		{"invalid value set by update", "UPDATE", map[string]string{"cost-center": "TODO"}, map[string]string{"cost-center": "finance"}, nil, SHOULD_REJECT, `namespace team-a has invalid labels: label cost-center value "TODO" is not allowed, allowed values are: finance, engineering`},
+		{"required label removed by update", "UPDATE", map[string]string{}, map[string]string{"cost-center": "finance"}, nil, SHOULD_REJECT, "namespace team-a has invalid labels: label cost-center is required"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := namespaceRequest(t, tc.operation, tc.labels, func(settings *Settings) {
+				settings.NamespaceValidation = validation
+				settings.NamespaceDefaults = tc.defaults
+			})
+			payload, err := updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				if tc.oldLabels != nil {
+					oldObject, err := json.Marshal(corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: tc.oldLabels}})
+					if err != nil {
+						t.Fatalf("Unexpected error: %+v", err)
+					}
+					request.OldObject = oldObject
+				}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			host.Client = mocks.NewMockWapcClient(t)
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, tc.accept, tc.defaults != nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !tc.accept && *response.Message != tc.message {
+				t.Errorf("Expected message %q, found %q", tc.message, *response.Message)
+			}
+		})
+	}
+}
+
+func TestNamespaceValidationSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name       string
+		validation NamespaceValidationSettings
+		valid      bool
+	}{
+		{"required labels", NamespaceValidationSettings{Required: []string{"cost-center"}}, true},
+		{"constrained labels", NamespaceValidationSettings{Labels: []LabelValueConstraint{{Label: "team", Pattern: "team-[a-z]+"}}}, true},
+		{"empty settings", NamespaceValidationSettings{}, false},
+		{"invalid required label", NamespaceValidationSettings{Required: []string{"not a label"}}, false},
+		{"invalid constraint", NamespaceValidationSettings{Labels: []LabelValueConstraint{{Label: "team"}}}, false},
+		{
+			"label constrained twice",
+			NamespaceValidationSettings{Labels: []LabelValueConstraint{{Label: "team", Pattern: "a"}, {Label: "team", Pattern: "b"}}},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, NamespaceValidation: &tc.validation}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// decodeObject parses a Kubernetes object into a generic JSON document.
+// The policy mutates this document instead of a typed struct, this ensures
+// fields that are unknown to the k8s-objects library, or that are set by
+// other admission controllers, are sent back untouched. Numbers are decoded
+// as json.Number to preserve their original representation.
+func decodeObject(raw []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	object := make(map[string]interface{})
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// nestedMap walks the object following the given path and returns the JSON
+// object found at its end. Returns `false` when one of the path elements is
+// missing, is null or is not a JSON object.
+func nestedMap(object map[string]interface{}, path ...string) (map[string]interface{}, bool) {
+	current := object
+	for _, key := range path {
+		value, found := current[key]
+		if !found || value == nil {
+			return nil, false
+		}
+		next, isMap := value.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// ensureMap returns the JSON object stored under `key`, creating it when the
+// key is missing or null. An error is returned when the key holds a value that
+// is not a JSON object.
+func ensureMap(parent map[string]interface{}, key string) (map[string]interface{}, error) {
+	value, found := parent[key]
+	if !found || value == nil {
+		newMap := make(map[string]interface{})
+		parent[key] = newMap
+		return newMap, nil
+	}
+	existing, isMap := value.(map[string]interface{})
+	if !isMap {
+		return nil, fmt.Errorf("%s is not an object", key)
+	}
+	return existing, nil
+}
+
+// metadataLabels returns the labels of the metadata found at the given path.
+// Only the last element of the path, the `metadata` key, and the `labels` key
+// inside of it are created when missing. Returns `false` when the object
+// holding the metadata does not exist, e.g. a pod template that is not
+// defined.
+func metadataLabels(object map[string]interface{}, metadataPath []string) (map[string]interface{}, bool, error) {
+	parentPath := metadataPath[:len(metadataPath)-1]
+	metadataKey := metadataPath[len(metadataPath)-1]
+
+	parent, found := nestedMap(object, parentPath...)
+	if !found {
+		return nil, false, nil
+	}
+	metadata, err := ensureMap(parent, metadataKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", strings.Join(parentPath, "."), err)
+	}
+	labels, err := ensureMap(metadata, "labels")
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", strings.Join(metadataPath, "."), err)
+	}
+	return labels, true, nil
+}
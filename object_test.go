@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const GOLDEN_DIR = "test_data/golden"
+
+// canonicalJSON re-encodes the given JSON document with sorted keys and no
+// whitespaces. Numbers are kept as they are written in the document.
+func canonicalJSON(raw []byte) ([]byte, error) {
+	document, err := decodeObject(raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// objectGVK returns the kind of the given object, as found in its
+// `apiVersion` and `kind` fields.
+func objectGVK(object map[string]interface{}) kubewarden_protocol.GroupVersionKind {
+	apiVersion := object["apiVersion"].(string)
+	gvk := kubewarden_protocol.GroupVersionKind{Version: apiVersion, Kind: object["kind"].(string)}
+	if group, version, found := strings.Cut(apiVersion, "/"); found {
+		gvk.Group = group
+		gvk.Version = version
+	}
+	return gvk
+}
+
+// The golden corpus is made of real manifests, with fields unknown to the
+// k8s-objects library. Each `<name>.json` file is mutated by the policy and
+// the result must match the `<name>.golden.json` file, which differs from
+// the original manifest only by the propagated labels.
+func TestMutationPreservesGoldenCorpus(t *testing.T) {
+	manifests, err := filepath.Glob(filepath.Join(GOLDEN_DIR, "*.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	labelsToPropagate := map[string]string{"cost-center": "finance"}
+
+	for _, manifest := range manifests {
+		if strings.HasSuffix(manifest, ".golden.json") {
+			continue
+		}
+		t.Run(filepath.Base(manifest), func(t *testing.T) {
+			rawObject, err := os.ReadFile(manifest)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			goldenObject, err := os.ReadFile(strings.TrimSuffix(manifest, ".json") + ".golden.json")
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			object, err := decodeObject(rawObject)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			request := kubewarden_protocol.ValidationRequest{}
+			request.Request.Kind = objectGVK(object)
+			request.Request.Object = rawObject
+
+			responsePayload, err := updateResourceLabels(request, labelsToPropagate, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response := struct {
+				Accepted      bool            `json:"accepted"`
+				MutatedObject json.RawMessage `json:"mutated_object"`
+			}{}
+			if err := json.Unmarshal(responsePayload, &response); err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !response.Accepted || response.MutatedObject == nil {
+				t.Fatalf("Expected the request to be accepted and mutated: %s", responsePayload)
+			}
+
+			mutated, err := canonicalJSON(response.MutatedObject)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			expected, err := canonicalJSON(goldenObject)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !bytes.Equal(mutated, expected) {
+				t.Errorf("Mutated object differs from the golden file.\nExpected: %s\nFound:    %s", expected, mutated)
+			}
+		})
+	}
+}
+
+func TestMetadataLabelsRejectsInvalidLabels(t *testing.T) {
+	object, err := decodeObject([]byte(`{"metadata": {"labels": ["not", "a", "map"]}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if _, _, err := metadataLabels(object, []string{"metadata"}); err == nil {
+		t.Errorf("Expected an error when labels are not an object")
+	}
+}
+
+func TestMetadataLabelsIgnoresMissingTemplate(t *testing.T) {
+	object, err := decodeObject([]byte(`{"metadata": {"name": "test"}, "spec": {}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	_, found, err := metadataLabels(object, []string{"spec", "template", "metadata"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if found {
+		t.Errorf("Missing pod template should not be created")
+	}
+	if _, hasTemplate := object["spec"].(map[string]interface{})["template"]; hasTemplate {
+		t.Errorf("Missing pod template should not be added to the object")
+	}
+}
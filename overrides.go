@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const (
+	// OPT_OUT_ANNOTATION holds a comma separated list of propagated labels
+	// that must not be set on the workload.
+	OPT_OUT_ANNOTATION = "namespace-label-propagator.kubewarden.io/opt-out"
+	// OVERRIDE_ANNOTATION holds a comma separated list of `<label>=<value>`
+	// pairs, defining the value to use for some propagated labels.
+	OVERRIDE_ANNOTATION = "namespace-label-propagator.kubewarden.io/override"
+)
+
+// defaultTrustedControllers lists the users the built-in controllers of
+// Kubernetes use to create the objects they manage. The first one is used
+// when the controller manager does not run with a service account per
+// controller.
+var defaultTrustedControllers = []string{
+	"system:kube-controller-manager",
+	"system:serviceaccount:kube-system:deployment-controller",
+	"system:serviceaccount:kube-system:replicaset-controller",
+	"system:serviceaccount:kube-system:replication-controller",
+	"system:serviceaccount:kube-system:statefulset-controller",
+	"system:serviceaccount:kube-system:daemon-set-controller",
+	"system:serviceaccount:kube-system:job-controller",
+	"system:serviceaccount:kube-system:cronjob-controller",
+}
+
+// WorkloadOverridesSettings defines the permission users must have to opt
+// out of propagated labels, or to override their values, using the workload
+// annotations. The permission is checked with a SubjectAccessReview on the
+// namespace of the workload, hence it can be a virtual verb and resource
+// granted via RBAC.
+type WorkloadOverridesSettings struct {
+	Verb     string `json:"verb"`
+	Group    string `json:"group"`
+	Resource string `json:"resource"`
+	// TrustedControllers lists the users whose requests for objects managed
+	// by a controller are not authorized, because they copy the annotations
+	// of an authorized object. Defaults to the built-in controllers.
+	TrustedControllers []string `json:"trustedControllers,omitempty"`
+}
+
+func (w *WorkloadOverridesSettings) Valid() error {
+	if w.Verb == "" || w.Resource == "" {
+		return errors.New("workloadOverrides requires both verb and resource")
+	}
+	if slices.Contains(w.TrustedControllers, "") {
+		return errors.New("workloadOverrides trustedControllers cannot contain empty usernames")
+	}
+	return nil
+}
+
+// trustsController returns `true` when the given user is one of the trusted
+// controllers.
+func (w *WorkloadOverridesSettings) trustsController(username string) bool {
+	if len(w.TrustedControllers) == 0 {
+		return slices.Contains(defaultTrustedControllers, username)
+	}
+	return slices.Contains(w.TrustedControllers, username)
+}
+
+func (w *WorkloadOverridesSettings) String() string {
+	if w.Group == "" {
+		return fmt.Sprintf("%s %s", w.Verb, w.Resource)
+	}
+	return fmt.Sprintf("%s %s.%s", w.Verb, w.Resource, w.Group)
+}
+
+// workloadOverrides holds the changes to the propagated labels requested
+// through the workload annotations.
+type workloadOverrides struct {
+	OptOut []string
+	Values map[string]string
+	// Annotations holds the annotations the overrides have been read from.
+	Annotations map[string]string
+}
+
+func (o *workloadOverrides) isEmpty() bool {
+	return len(o.OptOut) == 0 && len(o.Values) == 0
+}
+
+// apply returns a copy of the given labels, with the overrides applied.
+func (o *workloadOverrides) apply(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels))
+	for label, value := range labels {
+		result[label] = value
+	}
+	for label, value := range o.Values {
+		result[label] = value
+	}
+	for _, label := range o.OptOut {
+		delete(result, label)
+	}
+	return result
+}
+
+// overridesMetadata holds the fields of the object metadata used by the
+// workload overrides.
+type overridesMetadata struct {
+	Annotations     map[string]string `json:"annotations"`
+	OwnerReferences []ownerReference  `json:"ownerReferences"`
+}
+
+type ownerReference struct {
+	Controller bool `json:"controller"`
+}
+
+// objectMetadata returns the metadata of the given raw object. Missing
+// objects, like the old object of a CREATE request, have empty metadata.
+func objectMetadata(raw []byte) (overridesMetadata, error) {
+	object := struct {
+		Metadata overridesMetadata `json:"metadata"`
+	}{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return object.Metadata, nil
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return object.Metadata, err
+	}
+	return object.Metadata, nil
+}
+
+// hasController returns `true` when the object is managed by a controller,
+// e.g. a ReplicaSet created by a Deployment.
+func (m *overridesMetadata) hasController() bool {
+	return slices.ContainsFunc(m.OwnerReferences, func(owner ownerReference) bool { return owner.Controller })
+}
+
+// parseWorkloadOverrides reads the overrides defined by the given
+// annotations. Only propagated labels can be overridden.
+func parseWorkloadOverrides(annotations map[string]string, propagatedLabels []string) (workloadOverrides, error) {
+	overrides := workloadOverrides{Values: make(map[string]string), Annotations: make(map[string]string)}
+	for _, annotation := range []string{OPT_OUT_ANNOTATION, OVERRIDE_ANNOTATION} {
+		if value, found := annotations[annotation]; found {
+			overrides.Annotations[annotation] = value
+		}
+	}
+
+	for _, label := range strings.Split(annotations[OPT_OUT_ANNOTATION], ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		if !slices.Contains(propagatedLabels, label) {
+			return overrides, fmt.Errorf("annotation %s: label %q is not propagated by the policy", OPT_OUT_ANNOTATION, label)
+		}
+		overrides.OptOut = append(overrides.OptOut, label)
+	}
+
+	for _, pair := range strings.Split(annotations[OVERRIDE_ANNOTATION], ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		label, value, found := strings.Cut(pair, "=")
+		if !found {
+			return overrides, fmt.Errorf("annotation %s: %q must use the <label>=<value> format", OVERRIDE_ANNOTATION, pair)
+		}
+		if !slices.Contains(propagatedLabels, label) {
+			return overrides, fmt.Errorf("annotation %s: label %q is not propagated by the policy", OVERRIDE_ANNOTATION, label)
+		}
+		if err := validateLabelValue(value); err != nil {
+			return overrides, fmt.Errorf("annotation %s: %w", OVERRIDE_ANNOTATION, err)
+		}
+		overrides.Values[label] = value
+	}
+	return overrides, nil
+}
+
+// overridesChanged returns `true` when the request sets the override
+// annotations to values different from the ones of the old object. Requests
+// that keep the annotations untouched, e.g. a scale operation, do not need
+// to be authorized again.
+func overridesChanged(annotations, oldAnnotations map[string]string) bool {
+	for _, annotation := range []string{OPT_OUT_ANNOTATION, OVERRIDE_ANNOTATION} {
+		if annotations[annotation] != oldAnnotations[annotation] {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeWorkloadOverrides checks the user who made the request has the
+// permission to use the override annotations.
+func authorizeWorkloadOverrides(request kubewarden_protocol.KubernetesAdmissionRequest, settings Settings) error {
+	permission := settings.WorkloadOverrides
+	allowed, err := isAllowed(request, request.Namespace, permission.Verb, permission.Group, permission.Resource, settings.cacheDisabled(request.Operation))
+	if err != nil {
+		return &rejectionError{Code: 503, Err: fmt.Errorf("cannot check the permission to override propagated labels: %w", err)}
+	}
+	if !allowed {
+		return &rejectionError{Code: 403, Err: fmt.Errorf("user %s is not allowed to opt out of or override propagated labels: missing permission to %s in namespace %s", request.UserInfo.Username, permission, request.Namespace)}
+	}
+	return nil
+}
+
+// getWorkloadOverrides returns the overrides requested by the workload,
+// after checking the user is allowed to set them. Objects managed by a
+// controller, and created by a trusted one, are not authorized again: the
+// controller copied the annotations from its own object, which has been
+// authorized already. The owner references alone are not trusted, because
+// they are set by whoever creates the object.
+func getWorkloadOverrides(request kubewarden_protocol.KubernetesAdmissionRequest, settings Settings) (workloadOverrides, error) {
+	metadata, err := objectMetadata(request.Object)
+	if err != nil {
+		return workloadOverrides{}, err
+	}
+	overrides, err := parseWorkloadOverrides(metadata.Annotations, settings.propagatedLabelKeys())
+	if err != nil {
+		return workloadOverrides{}, err
+	}
+	if overrides.isEmpty() || (metadata.hasController() && settings.WorkloadOverrides.trustsController(request.UserInfo.Username)) {
+		return overrides, nil
+	}
+
+	oldMetadata, err := objectMetadata(request.OldObject)
+	if err != nil {
+		return workloadOverrides{}, err
+	}
+	if overridesChanged(metadata.Annotations, oldMetadata.Annotations) {
+		if err := authorizeWorkloadOverrides(request, settings); err != nil {
+			return workloadOverrides{}, err
+		}
+	}
+	return overrides, nil
+}
+
+// templateOverridesMutation sets the override annotations of the pod
+// templates to the ones of the workload. The objects created from the
+// templates, like the Pods of a ReplicaSet, get the same overrides, while
+// the annotations set directly inside of the templates, which have not been
+// authorized, are removed.
+func templateOverridesMutation(gvk kubewarden_protocol.GroupVersionKind, overrides workloadOverrides) objectMutation {
+	return func(object, _ map[string]interface{}) (bool, error) {
+		paths := metadataPaths[gvk]
+		if len(paths) < 2 {
+			return false, nil
+		}
+		hasMutation := false
+		for _, path := range paths[1:] {
+			metadata, found := nestedMap(object, path...)
+			if !found {
+				continue
+			}
+			for _, annotation := range []string{OPT_OUT_ANNOTATION, OVERRIDE_ANNOTATION} {
+				templateAnnotations, _ := nestedMap(metadata, "annotations")
+				oldValue, hadAnnotation := templateAnnotations[annotation]
+				value, hasAnnotation := overrides.Annotations[annotation]
+				switch {
+				case hasAnnotation && (!hadAnnotation || oldValue != value):
+					templateAnnotations, err := ensureMap(metadata, "annotations")
+					if err != nil {
+						return false, fmt.Errorf("%s: %w", strings.Join(path, "."), err)
+					}
+					templateAnnotations[annotation] = value
+					hasMutation = true
+				case !hasAnnotation && hadAnnotation:
+					delete(templateAnnotations, annotation)
+					hasMutation = true
+				}
+			}
+		}
+		return hasMutation, nil
+	}
+}
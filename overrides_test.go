@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	appsv1 "github.com/kubewarden/k8s-objects/api/apps/v1"
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+var testWorkloadOverrides = WorkloadOverridesSettings{
+	Verb:     "override",
+	Group:    "namespace-label-propagator.kubewarden.io",
+	Resource: "labels",
+}
+
+// overridesPermission is the permission checked for the workloads of the
+// test namespace.
+var overridesPermission = kubernetes.ResourceAttributes{
+	Namespace: TEST_NAMESPACE,
+	Verb:      testWorkloadOverrides.Verb,
+	Group:     testWorkloadOverrides.Group,
+	Resource:  testWorkloadOverrides.Resource,
+}
+
+func TestParseWorkloadOverrides(t *testing.T) {
+	propagatedLabels := []string{"cost-center", "team"}
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    map[string]string
+		valid       bool
+	}{
+		{"no annotations", nil, map[string]string{"cost-center": "finance", "team": "alpha"}, true},
+		{"opt out", map[string]string{OPT_OUT_ANNOTATION: "team"}, map[string]string{"cost-center": "finance"}, true},
+		{"override", map[string]string{OVERRIDE_ANNOTATION: "cost-center=shared, team=beta"}, map[string]string{"cost-center": "shared", "team": "beta"}, true},
+		{"opt out and override", map[string]string{OPT_OUT_ANNOTATION: "team", OVERRIDE_ANNOTATION: "cost-center=shared"}, map[string]string{"cost-center": "shared"}, true},
+		{"opt out of label not propagated", map[string]string{OPT_OUT_ANNOTATION: "owner"}, nil, false},
+		{"override label not propagated", map[string]string{OVERRIDE_ANNOTATION: "owner=bob"}, nil, false},
+		{"override without value", map[string]string{OVERRIDE_ANNOTATION: "cost-center"}, nil, false},
+		{"override with invalid value", map[string]string{OVERRIDE_ANNOTATION: "cost-center=not valid"}, nil, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			overrides, err := parseWorkloadOverrides(tc.annotations, propagatedLabels)
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid to be %t, error: %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+			labels := overrides.apply(map[string]string{"cost-center": "finance", "team": "alpha"})
+			if err := validateLabels(labels, tc.expected); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestWorkloadOverridesAuthorization(t *testing.T) {
+	cases := []struct {
+		name           string
+		operation      string
+		annotations    map[string]string
+		oldAnnotations map[string]string
+		checkAccess    bool
+		allowed        bool
+		accept         bool
+		expectedLabels map[string]string
+	}{
+		{"authorized override", "CREATE", map[string]string{OVERRIDE_ANNOTATION: "cost-center=shared"}, nil, true, true, SHOULD_ACCEPT, map[string]string{"cost-center": "shared"}},
+		{"authorized opt out", "CREATE", map[string]string{OPT_OUT_ANNOTATION: "cost-center"}, nil, true, true, SHOULD_ACCEPT, nil},
+		{"unauthorized override", "CREATE", map[string]string{OVERRIDE_ANNOTATION: "cost-center=shared"}, nil, true, false, SHOULD_REJECT, nil},
+		{"unauthorized override change", "UPDATE", map[string]string{OVERRIDE_ANNOTATION: "cost-center=shared"}, map[string]string{OVERRIDE_ANNOTATION: "cost-center=other"}, true, false, SHOULD_REJECT, nil},
+		{"unchanged override", "UPDATE", map[string]string{OVERRIDE_ANNOTATION: "cost-center=shared"}, map[string]string{OVERRIDE_ANNOTATION: "cost-center=shared"}, false, false, SHOULD_ACCEPT, map[string]string{"cost-center": "shared"}},
+		{"no overrides", "CREATE", nil, nil, false, false, SHOULD_ACCEPT, map[string]string{"cost-center": "finance"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE, Annotations: tc.annotations}}
+			oldResource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE, Annotations: tc.oldAnnotations}}
+			payload, err := buildValidationRequest([]string{"cost-center"}, resource, POD_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.WorkloadOverrides = &testWorkloadOverrides
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				request.Operation = tc.operation
+				request.UserInfo = kubewarden_protocol.UserInfo{Username: "alice"}
+				if tc.operation == "UPDATE" {
+					request.OldObject, _ = json.Marshal(oldResource)
+				}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			wapcClient := mockNamespaceLabels(t, map[string]string{"cost-center": "finance"})
+			if tc.checkAccess {
+				mockCanI(t, wapcClient, overridesPermission, "alice", tc.allowed, nil)
+			}
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, tc.accept, NO_MUTATION)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !tc.accept {
+				if *response.Code != 403 {
+					t.Errorf("Expected code 403, found %d", *response.Code)
+				}
+				return
+			}
+
+			labels := map[string]string{}
+			if response.MutatedObject != nil {
+				mutatedResourceJSON, err := json.Marshal(response.MutatedObject)
+				if err != nil {
+					t.Fatalf("Unexpected error: %+v", err)
+				}
+				mutated := corev1.Pod{}
+				if err := json.Unmarshal(mutatedResourceJSON, &mutated); err != nil {
+					t.Fatalf("Unexpected error: %+v", err)
+				}
+				labels = mutated.Metadata.Labels
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+// admitWithOverrides sends the given resource to the policy, with the
+// workload overrides enabled, and decodes the resulting object into
+// `admitted`.
+func admitWithOverrides(t *testing.T, resource interface{}, kind kubewarden_protocol.GroupVersionKind, username string, admitted interface{}) {
+	payload, err := buildValidationRequest([]string{"cost-center"}, resource, kind)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.WorkloadOverrides = &testWorkloadOverrides
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+		request.UserInfo = kubewarden_protocol.UserInfo{Username: username}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, NO_MUTATION)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	admittedJSON, err := json.Marshal(resource)
+	if response.MutatedObject != nil {
+		admittedJSON, err = json.Marshal(response.MutatedObject)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if err := json.Unmarshal(admittedJSON, admitted); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+}
+
+func TestWorkloadOverridesFollowTheControllers(t *testing.T) {
+	annotations := map[string]string{OPT_OUT_ANNOTATION: "cost-center"}
+	template := &corev1.PodTemplateSpec{Metadata: &metav1.ObjectMeta{Labels: map[string]string{"app": "web"}}}
+	deployment := appsv1.Deployment{
+		Metadata: &metav1.ObjectMeta{Name: "web", Namespace: TEST_NAMESPACE, Annotations: annotations},
+		Spec:     &appsv1.DeploymentSpec{Template: template},
+	}
+
+	wapcClient := mockNamespaceLabels(t, map[string]string{"cost-center": "finance"})
+	mockCanI(t, wapcClient, overridesPermission, "alice", true, nil)
+	admittedDeployment := appsv1.Deployment{}
+	admitWithOverrides(t, deployment, DEPLOYMENT_KIND, "alice", &admittedDeployment)
+	if value := admittedDeployment.Spec.Template.Metadata.Annotations[OPT_OUT_ANNOTATION]; value != "cost-center" {
+		t.Fatalf("Expected the opt out annotation to be copied to the pod template, found %q", value)
+	}
+
+	// The built-in controllers copy the annotations, and the pod template, to
+	// the objects they create. These objects must not be authorized again.
+	ownedBy := func(kind string) []*metav1.OwnerReference {
+		return []*metav1.OwnerReference{{Kind: &kind, Controller: true}}
+	}
+	replicaSet := appsv1.ReplicaSet{
+		Metadata: &metav1.ObjectMeta{Name: "web-5d8f", Namespace: TEST_NAMESPACE, Annotations: annotations, OwnerReferences: ownedBy("Deployment")},
+		Spec:     &appsv1.ReplicaSetSpec{Template: admittedDeployment.Spec.Template},
+	}
+	mockNamespaceLabels(t, map[string]string{"cost-center": "finance"})
+	admittedReplicaSet := appsv1.ReplicaSet{}
+	admitWithOverrides(t, replicaSet, REPLICASET_KIND, "system:serviceaccount:kube-system:deployment-controller", &admittedReplicaSet)
+	if _, found := admittedReplicaSet.Spec.Template.Metadata.Labels["cost-center"]; found {
+		t.Errorf("Opted out label should not be set on the ReplicaSet pod template")
+	}
+
+	pod := corev1.Pod{Metadata: &metav1.ObjectMeta{
+		Name:            "web-5d8f-x7k2p",
+		Namespace:       TEST_NAMESPACE,
+		Annotations:     admittedReplicaSet.Spec.Template.Metadata.Annotations,
+		Labels:          admittedReplicaSet.Spec.Template.Metadata.Labels,
+		OwnerReferences: ownedBy("ReplicaSet"),
+	}}
+	mockNamespaceLabels(t, map[string]string{"cost-center": "finance"})
+	admittedPod := corev1.Pod{}
+	admitWithOverrides(t, pod, POD_KIND, "system:serviceaccount:kube-system:replicaset-controller", &admittedPod)
+	if _, found := admittedPod.Metadata.Labels["cost-center"]; found {
+		t.Errorf("Opted out label should not be set on the Pod")
+	}
+}
+
+func TestTemplateOverridesAreReplacedByTheWorkloadOnes(t *testing.T) {
+	deployment := appsv1.Deployment{
+		Metadata: &metav1.ObjectMeta{Name: "web", Namespace: TEST_NAMESPACE},
+		Spec: &appsv1.DeploymentSpec{Template: &corev1.PodTemplateSpec{Metadata: &metav1.ObjectMeta{
+			Annotations: map[string]string{OPT_OUT_ANNOTATION: "cost-center", "owner": "alice"},
+		}}},
+	}
+
+	mockNamespaceLabels(t, map[string]string{"cost-center": "finance"})
+	admittedDeployment := appsv1.Deployment{}
+	admitWithOverrides(t, deployment, DEPLOYMENT_KIND, "bob", &admittedDeployment)
+	templateMetadata := admittedDeployment.Spec.Template.Metadata
+	if _, found := templateMetadata.Annotations[OPT_OUT_ANNOTATION]; found {
+		t.Errorf("Unauthorized opt out annotation should be removed from the pod template")
+	}
+	if templateMetadata.Annotations["owner"] != "alice" {
+		t.Errorf("Other annotations of the pod template should be kept")
+	}
+	if templateMetadata.Labels["cost-center"] != "finance" {
+		t.Errorf("Expected the label to be propagated to the pod template")
+	}
+}
+
+func TestWorkloadOverridesDoNotTrustOwnerReferences(t *testing.T) {
+	replicaSetKind := "ReplicaSet"
+	pod := corev1.Pod{Metadata: &metav1.ObjectMeta{
+		Name:            "test",
+		Namespace:       TEST_NAMESPACE,
+		Annotations:     map[string]string{OVERRIDE_ANNOTATION: "cost-center=someone-else"},
+		OwnerReferences: []*metav1.OwnerReference{{Kind: &replicaSetKind, Controller: true}},
+	}}
+	payload, err := buildValidationRequest([]string{"cost-center"}, pod, POD_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.WorkloadOverrides = &testWorkloadOverrides
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+		request.UserInfo = kubewarden_protocol.UserInfo{Username: "mallory"}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	wapcClient := mockNamespaceLabels(t, map[string]string{"cost-center": "finance"})
+	mockCanI(t, wapcClient, overridesPermission, "mallory", false, nil)
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_REJECT, NO_MUTATION)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if *response.Code != 403 {
+		t.Errorf("Expected code 403, found %d", *response.Code)
+	}
+}
+
+func TestTrustedControllers(t *testing.T) {
+	cases := []struct {
+		name     string
+		trusted  []string
+		username string
+		expected bool
+	}{
+		{"default controller", nil, "system:serviceaccount:kube-system:replicaset-controller", true},
+		{"controller manager", nil, "system:kube-controller-manager", true},
+		{"other user", nil, "mallory", false},
+		{"configured controller", []string{"system:serviceaccount:argo:workflow-controller"}, "system:serviceaccount:argo:workflow-controller", true},
+		{"default controller not configured", []string{"system:serviceaccount:argo:workflow-controller"}, "system:serviceaccount:kube-system:replicaset-controller", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := testWorkloadOverrides
+			settings.TrustedControllers = tc.trusted
+			if trusted := settings.trustsController(tc.username); trusted != tc.expected {
+				t.Errorf("Expected trusted to be %t", tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// claimNamespace returns the namespace of the PersistentVolumeClaim bound to
+// the PersistentVolume sent inside of the request. PersistentVolumes are
+// cluster-scoped, hence they are labeled using the namespace of their claim.
+// Returns `false` when the volume is not bound to a claim.
+func claimNamespace(request kubewarden_protocol.KubernetesAdmissionRequest) (string, bool, error) {
+	object, err := decodeObject(request.Object)
+	if err != nil {
+		return "", false, err
+	}
+	claimRef, found := nestedMap(object, "spec", "claimRef")
+	if !found {
+		return "", false, nil
+	}
+	namespace, _ := claimRef["namespace"].(string)
+	return namespace, namespace != "", nil
+}
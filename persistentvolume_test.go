@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// persistentVolumeRequest returns the request creating a cluster-scoped
+// PersistentVolume, bound to a claim of the given namespace.
+func persistentVolumeRequest(t *testing.T, claimNamespace string) []byte {
+	resource := corev1.PersistentVolume{
+		Metadata: &metav1.ObjectMeta{Name: "pvc-0a1b2c3d"},
+		Spec:     &corev1.PersistentVolumeSpec{},
+	}
+	if claimNamespace != "" {
+		resource.Spec.ClaimRef = &corev1.ObjectReference{Kind: "PersistentVolumeClaim", Name: "data", Namespace: claimNamespace}
+	}
+	payload, err := buildValidationRequest([]string{"cost-center"}, resource, PERSISTENTVOLUME_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+		request.Namespace = ""
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	return payload
+}
+
+func TestPersistentVolumeIsLabeledFromClaimNamespace(t *testing.T) {
+	payload := persistentVolumeRequest(t, "team-a")
+
+	wapcClient := mocks.NewMockWapcClient(t)
+	mockNamespaces(t, wapcClient, map[string]*corev1.Namespace{
+		"team-a": {Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"cost-center": "team-a"}}},
+	})
+	host.Client = wapcClient
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	labels, err := mutatedPodLabels(responsePayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if err := validateLabels(labels, map[string]string{"cost-center": "team-a"}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestUnboundPersistentVolumeIsAccepted(t *testing.T) {
+	payload := persistentVolumeRequest(t, "")
+
+	// no namespace is fetched for volumes not bound to a claim
+	host.Client = mocks.NewMockWapcClient(t)
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if _, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, NO_MUTATION); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestPersistentVolumeOfDeletedNamespaceIsAccepted(t *testing.T) {
+	for _, failurePolicy := range []string{"", FAILURE_POLICY_FAIL_CLOSED, FAILURE_POLICY_FAIL_OPEN} {
+		t.Run("failurePolicy "+failurePolicy, func(t *testing.T) {
+			payload := persistentVolumeRequest(t, "team-a")
+			payload, err := updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				request.Operation = "UPDATE"
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.FailurePolicy = failurePolicy
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			mockNamespaces(t, wapcClient, map[string]*corev1.Namespace{"team-a": nil})
+			host.Client = wapcClient
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if _, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, NO_MUTATION); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
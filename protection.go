@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// NamespaceProtectionSettings defines the permission users must have to
+// change the propagated labels of a namespace. The permission is checked
+// with a SubjectAccessReview on the namespace being updated, hence it can be
+// a virtual verb and resource granted via RBAC.
+type NamespaceProtectionSettings struct {
+	Verb     string `json:"verb"`
+	Group    string `json:"group"`
+	Resource string `json:"resource"`
+}
+
+func (n *NamespaceProtectionSettings) Valid() error {
+	if n.Verb == "" || n.Resource == "" {
+		return errors.New("namespaceProtection requires both verb and resource")
+	}
+	return nil
+}
+
+func (n *NamespaceProtectionSettings) String() string {
+	if n.Group == "" {
+		return fmt.Sprintf("%s %s", n.Verb, n.Resource)
+	}
+	return fmt.Sprintf("%s %s.%s", n.Verb, n.Resource, n.Group)
+}
+
+// valueChanged returns `true` when the given key is added, removed or
+// changed between the old and the new values.
+func valueChanged(values, oldValues map[string]string, key string) bool {
+	value, found := values[key]
+	oldValue, oldFound := oldValues[key]
+	return found != oldFound || value != oldValue
+}
+
+// changedPropagatedLabels returns the propagated labels that are added,
+// removed or changed by a namespace update, sorted by key.
+func changedPropagatedLabels(labels, oldLabels map[string]string, settings Settings) []string {
+	var changed []string
+	for _, label := range settings.propagatedLabelKeys() {
+		if valueChanged(labels, oldLabels, label) {
+			changed = append(changed, label)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// changedPropagationSources returns the namespace metadata, besides the
+// propagated labels, whose change alters the propagated values: the
+// annotations listed in `propagatedAnnotations`, and the annotation or label
+// holding the parent of the namespace when `namespaceHierarchy` is enabled.
+func changedPropagationSources(labels, oldLabels, annotations, oldAnnotations map[string]string, settings Settings) []string {
+	var sourceAnnotations, sourceLabels []string
+	for _, rule := range settings.PropagatedAnnotations {
+		sourceAnnotations = append(sourceAnnotations, rule.Annotation)
+	}
+	if hierarchy := settings.NamespaceHierarchy; hierarchy != nil {
+		if hierarchy.Annotation != "" {
+			sourceAnnotations = append(sourceAnnotations, hierarchy.Annotation)
+		}
+		if hierarchy.Label != "" {
+			sourceLabels = append(sourceLabels, hierarchy.Label)
+		}
+	}
+
+	var changed []string
+	for _, annotation := range sourceAnnotations {
+		if valueChanged(annotations, oldAnnotations, annotation) && !slices.Contains(changed, "annotation "+annotation) {
+			changed = append(changed, "annotation "+annotation)
+		}
+	}
+	for _, label := range sourceLabels {
+		if valueChanged(labels, oldLabels, label) {
+			changed = append(changed, "label "+label)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// authorizeNamespaceLabelChanges checks the user who updated the namespace
+// has the permission to change its propagated labels, and the annotations
+// and labels they are derived from. Updates that do not change any of them
+// are always allowed.
+func authorizeNamespaceLabelChanges(request kubewarden_protocol.KubernetesAdmissionRequest, labels, oldLabels map[string]string, settings Settings) error {
+	annotations, err := requestNamespaceAnnotations(request.Object)
+	if err != nil {
+		return &rejectionError{Code: 400, Err: err}
+	}
+	oldAnnotations, err := requestNamespaceAnnotations(request.OldObject)
+	if err != nil {
+		return &rejectionError{Code: 400, Err: err}
+	}
+	changed := append(changedPropagatedLabels(labels, oldLabels, settings), changedPropagationSources(labels, oldLabels, annotations, oldAnnotations, settings)...)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	permission := settings.NamespaceProtection
+	allowed, err := isAllowed(request, request.Name, permission.Verb, permission.Group, permission.Resource, settings.cacheDisabled(request.Operation))
+	if err != nil {
+		return &rejectionError{Code: 503, Err: fmt.Errorf("cannot check the permission to change propagated labels: %w", err)}
+	}
+	if !allowed {
+		return &rejectionError{Code: 403, Err: fmt.Errorf("user %s is not allowed to change the propagated labels, or their sources, %s: missing permission to %s in namespace %s", request.UserInfo.Username, strings.Join(changed, ", "), permission, request.Name)}
+	}
+	return nil
+}
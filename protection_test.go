@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+var testNamespaceProtection = &NamespaceProtectionSettings{
+	Verb:     "update",
+	Group:    "namespace-label-propagator.kubewarden.io",
+	Resource: "propagatedlabels",
+}
+
+// protectionPermission is the permission checked when the propagated labels
+// of the `team-a` namespace are changed.
+var protectionPermission = kubernetes.ResourceAttributes{
+	Namespace: "team-a",
+	Verb:      testNamespaceProtection.Verb,
+	Group:     testNamespaceProtection.Group,
+	Resource:  testNamespaceProtection.Resource,
+}
+
+func TestNamespaceProtection(t *testing.T) {
+	cases := []struct {
+		name      string
+		labels    map[string]string
+		checked   bool
+		allowed   bool
+		canIError error
+		accept    bool
+		code      uint16
+	}{
+		{"propagated labels unchanged", map[string]string{"cost-center": "finance", "other": "changed"}, false, false, nil, SHOULD_ACCEPT, 0},
+		{"change allowed", map[string]string{"cost-center": "engineering"}, true, true, nil, SHOULD_ACCEPT, 0},
+		{"change denied", map[string]string{"cost-center": "engineering"}, true, false, nil, SHOULD_REJECT, 403},
+		{"removal denied", map[string]string{}, true, false, nil, SHOULD_REJECT, 403},
+		{"addition denied", map[string]string{"cost-center": "finance", "team": "a"}, true, false, nil, SHOULD_REJECT, 403},
+		{"permission check failure", map[string]string{"cost-center": "engineering"}, true, false, errors.New("connection refused"), SHOULD_REJECT, 503},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := namespaceRequest(t, "UPDATE", tc.labels, func(settings *Settings) {
+				settings.NamespaceProtection = testNamespaceProtection
+			})
+			payload, err := updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				request.UserInfo.Username = "developer"
+				oldObject, err := json.Marshal(corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"cost-center": "finance", "other": "value"}}})
+				if err != nil {
+					t.Fatalf("Unexpected error: %+v", err)
+				}
+				request.OldObject = oldObject
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			if tc.checked {
+				mockCanI(t, wapcClient, protectionPermission, "developer", tc.allowed, tc.canIError)
+			}
+			host.Client = wapcClient
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, tc.accept, NO_MUTATION)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !tc.accept && *response.Code != tc.code {
+				t.Errorf("Expected code %d, found %d", tc.code, *response.Code)
+			}
+		})
+	}
+}
+
+func TestNamespaceProtectionCoversLabelSources(t *testing.T) {
+	cases := []struct {
+		name           string
+		settings       func(*Settings)
+		labels         map[string]string
+		oldLabels      map[string]string
+		annotations    map[string]string
+		oldAnnotations map[string]string
+		checked        bool
+	}{
+		{
+			"propagated annotation changed",
+			func(settings *Settings) {
+				settings.PropagatedAnnotations = []PropagatedAnnotationSettings{{Annotation: "finance.example.com/cost-center", Label: "cost-center"}}
+			},
+			nil, nil,
+			map[string]string{"finance.example.com/cost-center": "engineering"},
+			map[string]string{"finance.example.com/cost-center": "finance"},
+			true,
+		},
+		{
+			"parent label changed",
+			func(settings *Settings) {
+				settings.NamespaceHierarchy = &NamespaceHierarchySettings{Label: "parent"}
+			},
+			map[string]string{"parent": "engineering"},
+			map[string]string{"parent": "finance"},
+			nil, nil,
+			true,
+		},
+		{
+			"parent annotation changed",
+			func(settings *Settings) {
+				settings.NamespaceHierarchy = &NamespaceHierarchySettings{Annotation: "hnc.x-k8s.io/subnamespace-of"}
+			},
+			nil, nil,
+			map[string]string{"hnc.x-k8s.io/subnamespace-of": "engineering"},
+			map[string]string{"hnc.x-k8s.io/subnamespace-of": "finance"},
+			true,
+		},
+		{
+			"other annotation changed",
+			func(settings *Settings) {
+				settings.PropagatedAnnotations = []PropagatedAnnotationSettings{{Annotation: "finance.example.com/cost-center", Label: "cost-center"}}
+			},
+			nil, nil,
+			map[string]string{"description": "new"},
+			map[string]string{"description": "old"},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := namespaceRequest(t, "UPDATE", tc.labels, func(settings *Settings) {
+				settings.NamespaceProtection = testNamespaceProtection
+				tc.settings(settings)
+			})
+			payload, err := updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				request.UserInfo.Username = "developer"
+				object, err := json.Marshal(corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: tc.labels, Annotations: tc.annotations}})
+				if err != nil {
+					t.Fatalf("Unexpected error: %+v", err)
+				}
+				request.Object = object
+				oldObject, err := json.Marshal(corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: tc.oldLabels, Annotations: tc.oldAnnotations}})
+				if err != nil {
+					t.Fatalf("Unexpected error: %+v", err)
+				}
+				request.OldObject = oldObject
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			if tc.checked {
+				mockCanI(t, wapcClient, protectionPermission, "developer", false, nil)
+			}
+			host.Client = wapcClient
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, !tc.checked, NO_MUTATION)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if tc.checked && *response.Code != 403 {
+				t.Errorf("Expected code 403, found %d", *response.Code)
+			}
+		})
+	}
+}
+
+func TestNamespaceProtectionAppliesToExemptUsers(t *testing.T) {
+	payload := namespaceRequest(t, "UPDATE", map[string]string{"cost-center": "engineering"}, func(settings *Settings) {
+		settings.NamespaceProtection = testNamespaceProtection
+		settings.ExemptUsernames = []string{"backup"}
+	})
+	payload, err := updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+		request.UserInfo.Username = "backup"
+		oldObject, err := json.Marshal(corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"cost-center": "finance"}}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		request.OldObject = oldObject
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	wapcClient := mocks.NewMockWapcClient(t)
+	mockCanI(t, wapcClient, protectionPermission, "backup", false, nil)
+	host.Client = wapcClient
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_REJECT, NO_MUTATION)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if *response.Code != 403 {
+		t.Errorf("Expected code 403, found %d", *response.Code)
+	}
+}
+
+func TestNamespaceProtectionSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name       string
+		protection NamespaceProtectionSettings
+		valid      bool
+	}{
+		{"valid permission", *testNamespaceProtection, true},
+		{"core group", NamespaceProtectionSettings{Verb: "update", Resource: "propagatedlabels"}, true},
+		{"missing verb", NamespaceProtectionSettings{Resource: "propagatedlabels"}, false},
+		{"missing resource", NamespaceProtectionSettings{Verb: "update"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, NamespaceProtection: &tc.protection}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const (
+	// RANCHER_PROJECT_ID_ANNOTATION holds the `<cluster>:<project>` ID of
+	// the Rancher Project the namespace belongs to.
+	RANCHER_PROJECT_ID_ANNOTATION = "field.cattle.io/projectId"
+	// RANCHER_PROJECT_ID_LABEL holds the name of the Rancher Project the
+	// namespace belongs to.
+	RANCHER_PROJECT_ID_LABEL = "field.cattle.io/projectId"
+
+	RANCHER_PROJECT_API_VERSION = "management.cattle.io/v3"
+	RANCHER_PROJECT_KIND        = "Project"
+
+	DEFAULT_RANCHER_CLUSTER_NAME = "local"
+
+	METADATA_LABELS      = "labels"
+	METADATA_ANNOTATIONS = "annotations"
+)
+
+// RancherProjectSettings enables the propagation of the metadata defined by
+// the Rancher Project the namespace belongs to.
+type RancherProjectSettings struct {
+	// Metadata selects which metadata of the Project are propagation
+	// candidates: `labels` (default) or `annotations`.
+	Metadata string `json:"metadata,omitempty"`
+	// ClusterName is the name of the Rancher cluster, used when the
+	// namespace defines only the Project label. Defaults to `local`.
+	ClusterName string `json:"clusterName,omitempty"`
+}
+
+func (r *RancherProjectSettings) Valid() error {
+	switch r.Metadata {
+	case "", METADATA_LABELS, METADATA_ANNOTATIONS:
+	default:
+		return fmt.Errorf("rancherProject metadata must be either %q or %q", METADATA_LABELS, METADATA_ANNOTATIONS)
+	}
+	return nil
+}
+
+func (r *RancherProjectSettings) clusterName() string {
+	if r.ClusterName == "" {
+		return DEFAULT_RANCHER_CLUSTER_NAME
+	}
+	return r.ClusterName
+}
+
+// rancherProjectID returns the cluster and the name of the Rancher Project
+// the namespace belongs to. The Project annotation is preferred, because it
+// contains the cluster too. Returns `false` when the namespace does not
+// belong to any Project.
+func rancherProjectID(namespace *corev1.Namespace, settings *RancherProjectSettings) (string, string, bool, error) {
+	if projectID := namespace.Metadata.Annotations[RANCHER_PROJECT_ID_ANNOTATION]; projectID != "" {
+		cluster, project, found := strings.Cut(projectID, ":")
+		if !found || cluster == "" || project == "" {
+			return "", "", false, fmt.Errorf("namespace annotation %s has an invalid value %q", RANCHER_PROJECT_ID_ANNOTATION, projectID)
+		}
+		return cluster, project, true, nil
+	}
+	if project := namespace.Metadata.Labels[RANCHER_PROJECT_ID_LABEL]; project != "" {
+		return settings.clusterName(), project, true, nil
+	}
+	return "", "", false, nil
+}
+
+// rancherProjectLabels returns the propagation candidates defined by the
+// Rancher Project of the namespace. Namespaces not belonging to a Project,
+// or belonging to a Project that does not exist, have no candidates.
+func rancherProjectLabels(namespace *corev1.Namespace, validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	if settings.RancherProject == nil {
+		return nil, nil
+	}
+
+	cluster, projectName, found, err := rancherProjectID(namespace, settings.RancherProject)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	project := struct {
+		Metadata *metav1.ObjectMeta `json:"metadata"`
+	}{}
+	err = fetchResource(RANCHER_PROJECT_API_VERSION, RANCHER_PROJECT_KIND, projectName, &cluster, settings.cacheDisabled(validationRequest.Request.Operation), &project)
+	if isLookupNotFound(err) {
+		logger.WarnWith("rancher project not found").
+			String("uid", validationRequest.Request.Uid).
+			String("namespace", validationRequest.Request.Namespace).
+			String("project", cluster+":"+projectName).
+			Write()
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if project.Metadata == nil {
+		return nil, &lookupError{Reason: LOOKUP_INVALID, Err: errors.New("cannot parse project data: metadata is missing")}
+	}
+
+	if settings.RancherProject.Metadata == METADATA_ANNOTATIONS {
+		return project.Metadata.Annotations, nil
+	}
+	return project.Metadata.Labels, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// mockRancherProject configures the given client to answer the lookup of
+// the given Rancher Project. A nil project is reported as missing.
+func mockRancherProject(t *testing.T, wapcClient *mocks.MockWapcClient, cluster, name string, project *corev1.Namespace) {
+	request := kubernetes.GetResourceRequest{
+		APIVersion: RANCHER_PROJECT_API_VERSION,
+		Kind:       RANCHER_PROJECT_KIND,
+		Name:       name,
+		Namespace:  &cluster,
+	}
+	if project == nil {
+		mockGetResource(t, wapcClient, request, nil, errors.New(`projects.management.cattle.io "`+name+`" not found: NotFound`))
+		return
+	}
+	mockGetResource(t, wapcClient, request, project, nil)
+}
+
+func TestRancherProjectLabels(t *testing.T) {
+	project := &corev1.Namespace{Metadata: &metav1.ObjectMeta{
+		Name:        "p-xyz",
+		Labels:      map[string]string{"cost-center": "retail"},
+		Annotations: map[string]string{"owner": "team-alpha"},
+	}}
+
+	cases := []struct {
+		name           string
+		settings       RancherProjectSettings
+		namespace      *corev1.Namespace
+		cluster        string
+		project        *corev1.Namespace
+		expectedLabels map[string]string
+	}{
+		{
+			"project annotation",
+			RancherProjectSettings{},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Annotations: map[string]string{RANCHER_PROJECT_ID_ANNOTATION: "c-abc:p-xyz"}}},
+			"c-abc",
+			project,
+			map[string]string{"cost-center": "retail"},
+		},
+		{
+			"project label",
+			RancherProjectSettings{},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Labels: map[string]string{RANCHER_PROJECT_ID_LABEL: "p-xyz"}}},
+			"local",
+			project,
+			map[string]string{"cost-center": "retail"},
+		},
+		{
+			"project label with custom cluster",
+			RancherProjectSettings{ClusterName: "c-def"},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Labels: map[string]string{RANCHER_PROJECT_ID_LABEL: "p-xyz"}}},
+			"c-def",
+			project,
+			map[string]string{"cost-center": "retail"},
+		},
+		{
+			"project annotations",
+			RancherProjectSettings{Metadata: METADATA_ANNOTATIONS},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Annotations: map[string]string{RANCHER_PROJECT_ID_ANNOTATION: "c-abc:p-xyz"}}},
+			"c-abc",
+			project,
+			map[string]string{"owner": "team-alpha"},
+		},
+		{
+			"missing project",
+			RancherProjectSettings{},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Annotations: map[string]string{RANCHER_PROJECT_ID_ANNOTATION: "c-abc:p-xyz"}}},
+			"c-abc",
+			nil,
+			map[string]string{},
+		},
+		{
+			"namespace without project",
+			RancherProjectSettings{},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{}},
+			"",
+			nil,
+			map[string]string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, RancherProject: &tc.settings}
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			if tc.cluster != "" {
+				mockRancherProject(t, wapcClient, tc.cluster, "p-xyz", tc.project)
+			}
+			host.Client = wapcClient
+
+			labels, err := rancherProjectLabels(tc.namespace, kubewarden_protocol.ValidationRequest{}, settings)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestRancherProjectLabelsPrecedence(t *testing.T) {
+	resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+	payload, err := buildValidationRequest([]string{"cost-center", "owner"}, resource, POD_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.RancherProject = &RancherProjectSettings{}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	wapcClient := mockNamespaceLabels(t, map[string]string{RANCHER_PROJECT_ID_LABEL: "p-xyz", "cost-center": "namespace-value"})
+	mockRancherProject(t, wapcClient, "local", "p-xyz", &corev1.Namespace{Metadata: &metav1.ObjectMeta{
+		Labels: map[string]string{"cost-center": "project-value", "owner": "team-alpha"},
+	}})
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	labels, err := mutatedPodLabels(responsePayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if err := validateLabels(labels, map[string]string{"cost-center": "namespace-value", "owner": "team-alpha"}); err != nil {
+		t.Error(err.Error())
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// ReferencedResourceSettings defines an object referenced by the namespace,
+// e.g. the Capsule Tenant owning it, whose labels are propagation
+// candidates. The name of the object is read from either a namespace label
+// or the namespace owner references.
+type ReferencedResourceSettings struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// NameLabel is the namespace label holding the name of the object.
+	NameLabel string `json:"nameLabel,omitempty"`
+	// OwnerReference looks up the name of the object among the owners of
+	// the namespace with the same apiVersion and kind.
+	OwnerReference bool `json:"ownerReference,omitempty"`
+	// Namespace of the object. Must be empty for cluster wide resources.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (r *ReferencedResourceSettings) Valid() error {
+	if r.APIVersion == "" || r.Kind == "" {
+		return errors.New("referencedResources entries require both apiVersion and kind")
+	}
+	if (r.NameLabel == "") == !r.OwnerReference {
+		return fmt.Errorf("referencedResources entry %s %s requires either nameLabel or ownerReference", r.APIVersion, r.Kind)
+	}
+	return nil
+}
+
+// referencedName returns the name of the object referenced by the namespace.
+// An empty string is returned when the namespace does not reference any
+// object.
+func (r *ReferencedResourceSettings) referencedName(namespace *corev1.Namespace) string {
+	if r.NameLabel != "" {
+		return namespace.Metadata.Labels[r.NameLabel]
+	}
+	for _, owner := range namespace.Metadata.OwnerReferences {
+		if owner == nil || owner.APIVersion == nil || owner.Kind == nil || owner.Name == nil {
+			continue
+		}
+		if *owner.APIVersion == r.APIVersion && *owner.Kind == r.Kind {
+			return *owner.Name
+		}
+	}
+	return ""
+}
+
+// referencedResourcesLabels returns the propagation candidates defined by the
+// objects referenced by the namespace. When more objects define the same
+// label, the first one listed in the settings wins. Missing objects are
+// skipped.
+func referencedResourcesLabels(namespace *corev1.Namespace, validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, reference := range settings.ReferencedResources {
+		name := reference.referencedName(namespace)
+		if name == "" {
+			continue
+		}
+
+		var objectNamespace *string
+		if reference.Namespace != "" {
+			objectNamespace = &reference.Namespace
+		}
+		object := struct {
+			Metadata *metav1.ObjectMeta `json:"metadata"`
+		}{}
+		err := fetchResource(reference.APIVersion, reference.Kind, name, objectNamespace, settings.cacheDisabled(validationRequest.Request.Operation), &object)
+		if isLookupNotFound(err) {
+			logger.WarnWith("referenced resource not found").
+				String("uid", validationRequest.Request.Uid).
+				String("namespace", validationRequest.Request.Namespace).
+				String("apiVersion", reference.APIVersion).
+				String("kind", reference.Kind).
+				String("name", name).
+				Write()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if object.Metadata == nil {
+			return nil, &lookupError{Reason: LOOKUP_INVALID, Err: fmt.Errorf("cannot parse %s data: metadata is missing", reference.Kind)}
+		}
+		mergeMissingLabels(labels, object.Metadata.Labels)
+	}
+	return labels, nil
+}
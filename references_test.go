@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const (
+	TENANT_API_VERSION = "capsule.clastix.io/v1beta2"
+	TENANT_KIND        = "Tenant"
+)
+
+// metadataObject returns an object having only the given labels.
+func metadataObject(labels map[string]string) map[string]interface{} {
+	return map[string]interface{}{"metadata": map[string]interface{}{"labels": labels}}
+}
+
+func TestReferencedResourcesLabels(t *testing.T) {
+	tenantAPIVersion := TENANT_API_VERSION
+	tenantKind := TENANT_KIND
+	tenantName := "oil"
+
+	cases := []struct {
+		name           string
+		references     []ReferencedResourceSettings
+		namespace      *corev1.Namespace
+		mock           func(*testing.T, *mocks.MockWapcClient)
+		expectedLabels map[string]string
+	}{
+		{
+			"tenant from namespace label",
+			[]ReferencedResourceSettings{{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, NameLabel: "capsule.clastix.io/tenant"}},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Labels: map[string]string{"capsule.clastix.io/tenant": "oil"}}},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockGetResource(t, wapcClient, kubernetes.GetResourceRequest{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, Name: "oil"}, metadataObject(map[string]string{"cost-center": "oil"}), nil)
+			},
+			map[string]string{"cost-center": "oil"},
+		},
+		{
+			"tenant from owner reference",
+			[]ReferencedResourceSettings{{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, OwnerReference: true}},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{OwnerReferences: []*metav1.OwnerReference{{APIVersion: &tenantAPIVersion, Kind: &tenantKind, Name: &tenantName}}}},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockGetResource(t, wapcClient, kubernetes.GetResourceRequest{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, Name: "oil"}, metadataObject(map[string]string{"cost-center": "oil"}), nil)
+			},
+			map[string]string{"cost-center": "oil"},
+		},
+		{
+			"namespaced object and first reference wins",
+			[]ReferencedResourceSettings{
+				{APIVersion: "example.com/v1", Kind: "Team", NameLabel: "team", Namespace: "teams"},
+				{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, NameLabel: "capsule.clastix.io/tenant"},
+			},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Labels: map[string]string{"capsule.clastix.io/tenant": "oil", "team": "drillers"}}},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				teamsNamespace := "teams"
+				mockGetResource(t, wapcClient, kubernetes.GetResourceRequest{APIVersion: "example.com/v1", Kind: "Team", Name: "drillers", Namespace: &teamsNamespace}, metadataObject(map[string]string{"cost-center": "drillers"}), nil)
+				mockGetResource(t, wapcClient, kubernetes.GetResourceRequest{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, Name: "oil"}, metadataObject(map[string]string{"cost-center": "oil", "owner": "oil-team"}), nil)
+			},
+			map[string]string{"cost-center": "drillers", "owner": "oil-team"},
+		},
+		{
+			"missing tenant",
+			[]ReferencedResourceSettings{{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, NameLabel: "capsule.clastix.io/tenant"}},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{Labels: map[string]string{"capsule.clastix.io/tenant": "oil"}}},
+			func(t *testing.T, wapcClient *mocks.MockWapcClient) {
+				mockGetResource(t, wapcClient, kubernetes.GetResourceRequest{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, Name: "oil"}, nil, errors.New(`tenants.capsule.clastix.io "oil" not found: NotFound`))
+			},
+			map[string]string{},
+		},
+		{
+			"namespace without references",
+			[]ReferencedResourceSettings{{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, OwnerReference: true}},
+			&corev1.Namespace{Metadata: &metav1.ObjectMeta{}},
+			func(*testing.T, *mocks.MockWapcClient) {},
+			map[string]string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, ReferencedResources: tc.references}
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			tc.mock(t, wapcClient)
+			host.Client = wapcClient
+
+			labels, err := referencedResourcesLabels(tc.namespace, kubewarden_protocol.ValidationRequest{}, settings)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestReferencedResourcesSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name      string
+		reference ReferencedResourceSettings
+		valid     bool
+	}{
+		{"name label", ReferencedResourceSettings{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, NameLabel: "capsule.clastix.io/tenant"}, true},
+		{"owner reference", ReferencedResourceSettings{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, OwnerReference: true}, true},
+		{"missing kind", ReferencedResourceSettings{APIVersion: TENANT_API_VERSION, NameLabel: "tenant"}, false},
+		{"missing name source", ReferencedResourceSettings{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND}, false},
+		{"both name sources", ReferencedResourceSettings{APIVersion: TENANT_API_VERSION, Kind: TENANT_KIND, NameLabel: "tenant", OwnerReference: true}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"cost-center"}, ReferencedResources: []ReferencedResourceSettings{tc.reference}}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	kubewarden "github.com/kubewarden/policy-sdk-go"
+	kubernetes "github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const (
+	// LOOKUP_NOT_FOUND is used when the resource does not exist, e.g.
+	// because the request raced with the namespace creation.
+	LOOKUP_NOT_FOUND = "NotFound"
+	// LOOKUP_UNAVAILABLE is used when the host could not fetch the resource,
+	// e.g. because of an API server hiccup.
+	LOOKUP_UNAVAILABLE = "Unavailable"
+	// LOOKUP_INVALID is used when the resource data cannot be parsed.
+	LOOKUP_INVALID = "Invalid"
+)
+
+// lookupCodes maps each lookup failure reason to the code used when
+// rejecting the request.
+var lookupCodes = map[string]kubewarden.Code{
+	LOOKUP_NOT_FOUND:   kubewarden.Code(404),
+	LOOKUP_UNAVAILABLE: kubewarden.Code(503),
+	LOOKUP_INVALID:     kubewarden.Code(500),
+}
+
+// lookupError is returned when a resource needed by the policy cannot be
+// fetched or parsed.
+type lookupError struct {
+	Reason string
+	Err    error
+}
+
+func (e *lookupError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *lookupError) Unwrap() error {
+	return e.Err
+}
+
+// notFoundRegexp matches the error reported by the host when the requested
+// object does not exist: the message of the API server, `<resource> "<name>"
+// not found`, followed by the `NotFound` reason. Other errors with the same
+// reason, like a resource type unknown to the API server, do not name the
+// object.
+var notFoundRegexp = regexp.MustCompile(`"[^"]+" not found: NotFound\b`)
+
+// isNotFoundError returns `true` when the error returned by the host
+// describes a resource that does not exist.
+func isNotFoundError(err error) bool {
+	return notFoundRegexp.MatchString(err.Error())
+}
+
+// isLookupNotFound returns `true` when the error is a lookup failure caused
+// by a missing resource.
+func isLookupNotFound(err error) bool {
+	lookupErr := &lookupError{}
+	return errors.As(err, &lookupErr) && lookupErr.Reason == LOOKUP_NOT_FOUND
+}
+
+// fetchResource gets the resource with the given name using the host
+// capabilities, and parses it into `resource`. The namespace must be nil for
+// cluster wide resources.
+func fetchResource(apiVersion, kind, name string, namespace *string, disableCache bool, resource interface{}) error {
+	resourceRequest := kubernetes.GetResourceRequest{
+		APIVersion:   apiVersion,
+		Kind:         kind,
+		Name:         name,
+		Namespace:    namespace,
+		DisableCache: disableCache,
+	}
+
+	resourceName := strings.ToLower(kind)
+	responseBytes, err := kubernetes.GetResource(&host, resourceRequest)
+	if err != nil {
+		reason := LOOKUP_UNAVAILABLE
+		if isNotFoundError(err) {
+			reason = LOOKUP_NOT_FOUND
+		}
+		return &lookupError{Reason: reason, Err: fmt.Errorf("cannot get %s data: %s", resourceName, err)}
+	}
+	if err := json.Unmarshal(responseBytes, resource); err != nil {
+		return &lookupError{Reason: LOOKUP_INVALID, Err: fmt.Errorf("cannot parse %s data: %s", resourceName, err)}
+	}
+	return nil
+}
+
+// handleLookupFailure builds the response for a request whose namespace, or
+// any other resource used as source of the labels, could not be obtained.
+// Lookup failures are handled according to the failure policy defined in the
+// settings, all the other errors cause the request to be rejected.
+func handleLookupFailure(validationRequest kubewarden_protocol.ValidationRequest, settings Settings, err error) ([]byte, error) {
+	lookupErr := &lookupError{}
+	if !errors.As(err, &lookupErr) {
+		return rejectWithError(err)
+	}
+
+	if settings.FailurePolicy == FAILURE_POLICY_FAIL_OPEN {
+		logger.WarnWith("lookup failed, accepting request without changes").
+			String("uid", validationRequest.Request.Uid).
+			String("namespace", validationRequest.Request.Namespace).
+			String("reason", lookupErr.Reason).
+			Err("error", lookupErr.Err).
+			Write()
+		return kubewarden.AcceptRequest()
+	}
+	return kubewarden.RejectRequest(kubewarden.Message(lookupErr.Error()), lookupCodes[lookupErr.Reason])
+}
+
+// isAllowed checks, with a SubjectAccessReview, whether the user who made the
+// request has the given permission inside of the namespace.
+func isAllowed(request kubewarden_protocol.KubernetesAdmissionRequest, namespace, verb, group, resource string, disableCache bool) (bool, error) {
+	accessReview := kubernetes.SubjectAccessReviewRequest{
+		APIVersion: "authorization.k8s.io/v1",
+		Kind:       "SubjectAccessReview",
+		Spec: kubernetes.SubjectAccessReviewSpec{
+			ResourceAttributes: kubernetes.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     group,
+				Resource:  resource,
+			},
+			User:   request.UserInfo.Username,
+			Groups: request.UserInfo.Groups,
+		},
+		DisableCache: disableCache,
+	}
+
+	status, err := kubernetes.CanI(&host, accessReview)
+	if err != nil {
+		return false, err
+	}
+	return status.Allowed, nil
+}
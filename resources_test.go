@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+)
+
+// mockCanI configures the given client to answer the SubjectAccessReview of
+// the given permission, namespace included, for the given user.
+func mockCanI(t *testing.T, wapcClient *mocks.MockWapcClient, permission kubernetes.ResourceAttributes, username string, allowed bool, err error) {
+	wapcRequest, marshalErr := json.Marshal(&kubernetes.SubjectAccessReviewRequest{
+		APIVersion: "authorization.k8s.io/v1",
+		Kind:       "SubjectAccessReview",
+		Spec: kubernetes.SubjectAccessReviewSpec{
+			ResourceAttributes: permission,
+			User:               username,
+		},
+	})
+	if marshalErr != nil {
+		t.Fatalf("Cannot create wapcRequest payload: %+v", marshalErr)
+	}
+	wapcResponse, marshalErr := json.Marshal(&kubernetes.SubjectAccessReviewStatus{Allowed: allowed})
+	if marshalErr != nil {
+		t.Fatalf("Cannot create wapcResponse payload: %+v", marshalErr)
+	}
+	wapcClient.On("HostCall", "kubewarden", "kubernetes", "can_i", wapcRequest).Return(wapcResponse, err)
+}
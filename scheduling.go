@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	SCHEDULING_CONFLICT_KEEP      = "keep"
+	SCHEDULING_CONFLICT_OVERWRITE = "overwrite"
+	SCHEDULING_CONFLICT_REJECT    = "reject"
+)
+
+// tolerationEffects lists the effects a toleration can match, the empty one
+// matches all of them.
+var tolerationEffects = []string{"", "NoSchedule", "PreferNoSchedule", "NoExecute"}
+
+// SchedulingSettings defines the namespace labels turned into scheduling
+// constraints of the pods.
+type SchedulingSettings struct {
+	Rules []SchedulingRule `json:"rules"`
+	// OnConflict defines what to do when the pod spec already defines the
+	// node selector with a different value: `keep` (default) the value of
+	// the pod spec, `overwrite` it or `reject` the request.
+	OnConflict string `json:"onConflict,omitempty"`
+}
+
+// SchedulingRule turns the value of a namespace label into a node selector
+// entry and, optionally, into a toleration of the same value.
+type SchedulingRule struct {
+	Label string `json:"label"`
+	// NodeSelector is the key of the node selector entry. Defaults to the
+	// label key.
+	NodeSelector string                `json:"nodeSelector,omitempty"`
+	Toleration   *SchedulingToleration `json:"toleration,omitempty"`
+}
+
+// SchedulingToleration defines the toleration added to the pods. The value
+// of the toleration is the value of the namespace label.
+type SchedulingToleration struct {
+	// Key is the taint key tolerated by the pods. Defaults to the node
+	// selector key.
+	Key    string `json:"key,omitempty"`
+	Effect string `json:"effect,omitempty"`
+}
+
+func (s *SchedulingSettings) Valid() error {
+	if len(s.Rules) == 0 {
+		return errors.New("scheduling requires at least one rule")
+	}
+	for _, rule := range s.Rules {
+		if err := validateLabelKey(rule.Label); err != nil {
+			return fmt.Errorf("scheduling rule: %w", err)
+		}
+		if err := validateLabelKey(rule.nodeSelectorKey()); err != nil {
+			return fmt.Errorf("scheduling rule %s nodeSelector: %w", rule.Label, err)
+		}
+		if rule.Toleration == nil {
+			continue
+		}
+		if err := validateLabelKey(rule.tolerationKey()); err != nil {
+			return fmt.Errorf("scheduling rule %s toleration: %w", rule.Label, err)
+		}
+		if !slices.Contains(tolerationEffects, rule.Toleration.Effect) {
+			return fmt.Errorf("scheduling rule %s toleration has an invalid effect %q", rule.Label, rule.Toleration.Effect)
+		}
+	}
+	switch s.OnConflict {
+	case "", SCHEDULING_CONFLICT_KEEP, SCHEDULING_CONFLICT_OVERWRITE, SCHEDULING_CONFLICT_REJECT:
+	default:
+		return fmt.Errorf("scheduling onConflict must be one of %q, %q or %q", SCHEDULING_CONFLICT_KEEP, SCHEDULING_CONFLICT_OVERWRITE, SCHEDULING_CONFLICT_REJECT)
+	}
+	return nil
+}
+
+func (r *SchedulingRule) nodeSelectorKey() string {
+	if r.NodeSelector == "" {
+		return r.Label
+	}
+	return r.NodeSelector
+}
+
+func (r *SchedulingRule) tolerationKey() string {
+	if r.Toleration.Key == "" {
+		return r.nodeSelectorKey()
+	}
+	return r.Toleration.Key
+}
+
+// schedulingMutation returns the mutation adding the node selector entries,
+// and the tolerations, defined by the settings to the pod spec. Rules whose
+// label is missing from the candidates are skipped.
+func schedulingMutation(candidates map[string]string, settings *SchedulingSettings) objectMutation {
+	return func(object map[string]interface{}, podSpec map[string]interface{}) (bool, error) {
+		if podSpec == nil {
+			return false, nil
+		}
+		hasMutation := false
+		for _, rule := range settings.Rules {
+			value, found := candidates[rule.Label]
+			if !found {
+				continue
+			}
+			key := rule.nodeSelectorKey()
+			changed, err := setNodeSelector(podSpec, key, value, settings.OnConflict)
+			if err != nil {
+				return false, err
+			}
+			hasMutation = hasMutation || changed
+			if rule.Toleration == nil {
+				continue
+			}
+			// the toleration is added only when the pods are scheduled on
+			// the nodes selected by the namespace value
+			if nodeSelector, _ := nestedMap(podSpec, "nodeSelector"); nodeSelector[key] != value {
+				continue
+			}
+			changed, err = addToleration(podSpec, rule.tolerationKey(), value, rule.Toleration.Effect)
+			if err != nil {
+				return false, err
+			}
+			hasMutation = hasMutation || changed
+		}
+		return hasMutation, nil
+	}
+}
+
+// setNodeSelector sets the given node selector entry, according to the
+// conflict policy. Returns `true` when the pod spec has been changed.
+func setNodeSelector(podSpec map[string]interface{}, key, value, onConflict string) (bool, error) {
+	nodeSelector, err := ensureMap(podSpec, "nodeSelector")
+	if err != nil {
+		return false, err
+	}
+	existing, found := nodeSelector[key]
+	if !found {
+		nodeSelector[key] = value
+		return true, nil
+	}
+	if existing == value {
+		return false, nil
+	}
+	switch onConflict {
+	case SCHEDULING_CONFLICT_OVERWRITE:
+		nodeSelector[key] = value
+		return true, nil
+	case SCHEDULING_CONFLICT_REJECT:
+		return false, &rejectionError{Code: 400, Err: fmt.Errorf("node selector %s=%v conflicts with the value %s defined by the namespace", key, existing, value)}
+	}
+	return false, nil
+}
+
+// addToleration adds the toleration of the given taint, unless the pod spec
+// already defines it. Returns `true` when the pod spec has been changed.
+func addToleration(podSpec map[string]interface{}, key, value, effect string) (bool, error) {
+	tolerations, isList := podSpec["tolerations"].([]interface{})
+	if !isList && podSpec["tolerations"] != nil {
+		return false, errors.New("tolerations is not a list")
+	}
+	for _, item := range tolerations {
+		toleration, isMap := item.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		tolerationEffect, _ := toleration["effect"].(string)
+		if toleration["key"] == key && toleration["value"] == value && tolerationEffect == effect {
+			return false, nil
+		}
+	}
+	toleration := map[string]interface{}{"key": key, "operator": "Equal", "value": value}
+	if effect != "" {
+		toleration["effect"] = effect
+	}
+	podSpec["tolerations"] = append(tolerations, toleration)
+	return true, nil
+}
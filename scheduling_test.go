@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	appsv1 "github.com/kubewarden/k8s-objects/api/apps/v1"
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSchedulingMutation(t *testing.T) {
+	candidates := map[string]string{"node-pool": "gpu", "dedicated": "team-a"}
+	rules := []SchedulingRule{
+		{Label: "node-pool", NodeSelector: "example.com/node-pool"},
+		{Label: "dedicated", Toleration: &SchedulingToleration{Effect: "NoSchedule"}},
+		{Label: "missing", Toleration: &SchedulingToleration{}},
+	}
+
+	cases := []struct {
+		name        string
+		podSpec     string
+		onConflict  string
+		valid       bool
+		mutated     bool
+		expectedPod string
+	}{
+		{
+			"empty pod spec",
+			`{}`,
+			"",
+			true,
+			true,
+			`{"nodeSelector":{"dedicated":"team-a","example.com/node-pool":"gpu"},"tolerations":[{"effect":"NoSchedule","key":"dedicated","operator":"Equal","value":"team-a"}]}`,
+		},
+		{
+			"already scheduled",
+			`{"nodeSelector":{"dedicated":"team-a","example.com/node-pool":"gpu"},"tolerations":[{"effect":"NoSchedule","key":"dedicated","operator":"Equal","value":"team-a"}]}`,
+			SCHEDULING_CONFLICT_REJECT,
+			true,
+			false,
+			`{"nodeSelector":{"dedicated":"team-a","example.com/node-pool":"gpu"},"tolerations":[{"effect":"NoSchedule","key":"dedicated","operator":"Equal","value":"team-a"}]}`,
+		},
+		{
+			"conflict kept",
+			`{"nodeSelector":{"dedicated":"team-b"}}`,
+			"",
+			true,
+			true,
+			`{"nodeSelector":{"dedicated":"team-b","example.com/node-pool":"gpu"}}`,
+		},
+		{
+			"conflict overwritten",
+			`{"nodeSelector":{"dedicated":"team-b"}}`,
+			SCHEDULING_CONFLICT_OVERWRITE,
+			true,
+			true,
+			`{"nodeSelector":{"dedicated":"team-a","example.com/node-pool":"gpu"},"tolerations":[{"effect":"NoSchedule","key":"dedicated","operator":"Equal","value":"team-a"}]}`,
+		},
+		{
+			"conflict rejected",
+			`{"nodeSelector":{"dedicated":"team-b"}}`,
+			SCHEDULING_CONFLICT_REJECT,
+			false,
+			false,
+			"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			podSpec, err := decodeObject([]byte(tc.podSpec))
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			mutation := schedulingMutation(candidates, &SchedulingSettings{Rules: rules, OnConflict: tc.onConflict})
+			mutated, err := mutation(nil, podSpec)
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid to be %t, error: %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+			if mutated != tc.mutated {
+				t.Errorf("Expected mutated to be %t", tc.mutated)
+			}
+			result, err := json.Marshal(podSpec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if string(result) != tc.expectedPod {
+				t.Errorf("Expected pod spec %s, found %s", tc.expectedPod, result)
+			}
+		})
+	}
+}
+
+func TestSchedulingConstraintsAreApplied(t *testing.T) {
+	resource := appsv1.Deployment{
+		Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE},
+		Spec: &appsv1.DeploymentSpec{
+			Template: &corev1.PodTemplateSpec{Metadata: &metav1.ObjectMeta{}, Spec: &corev1.PodSpec{}},
+		},
+	}
+	payload, err := buildValidationRequest(nil, resource, DEPLOYMENT_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.Scheduling = &SchedulingSettings{Rules: []SchedulingRule{{Label: "node-pool", Toleration: &SchedulingToleration{}}}}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	mockNamespaceLabels(t, map[string]string{"node-pool": "gpu"})
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, SHOULD_MUTATE)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	mutatedResourceJSON, err := json.Marshal(response.MutatedObject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	deployment := appsv1.Deployment{}
+	if err := json.Unmarshal(mutatedResourceJSON, &deployment); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	podSpec := deployment.Spec.Template.Spec
+	if podSpec.NodeSelector["node-pool"] != "gpu" {
+		t.Errorf("Missing node selector: %s", mutatedResourceJSON)
+	}
+	if len(podSpec.Tolerations) != 1 || podSpec.Tolerations[0].Key != "node-pool" || podSpec.Tolerations[0].Value != "gpu" {
+		t.Errorf("Missing toleration: %s", mutatedResourceJSON)
+	}
+}
+
+func TestSchedulingSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings SchedulingSettings
+		valid    bool
+	}{
+		{"valid settings", SchedulingSettings{Rules: []SchedulingRule{{Label: "dedicated", Toleration: &SchedulingToleration{Effect: "NoExecute"}}}, OnConflict: SCHEDULING_CONFLICT_REJECT}, true},
+		{"no rules", SchedulingSettings{}, false},
+		{"invalid label", SchedulingSettings{Rules: []SchedulingRule{{Label: "not a label"}}}, false},
+		{"invalid node selector", SchedulingSettings{Rules: []SchedulingRule{{Label: "dedicated", NodeSelector: "/pool"}}}, false},
+		{"invalid effect", SchedulingSettings{Rules: []SchedulingRule{{Label: "dedicated", Toleration: &SchedulingToleration{Effect: "Evict"}}}}, false},
+		{"invalid onConflict", SchedulingSettings{Rules: []SchedulingRule{{Label: "dedicated"}}, OnConflict: "merge"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{Scheduling: &tc.settings}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
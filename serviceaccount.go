@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+const (
+	SERVICE_ACCOUNT_PRECEDENCE_NAMESPACE       = "namespace"
+	SERVICE_ACCOUNT_PRECEDENCE_SERVICE_ACCOUNT = "serviceAccount"
+
+	DEFAULT_SERVICE_ACCOUNT_NAME = "default"
+)
+
+// ServiceAccountSourceSettings enables the propagation of the labels of the
+// ServiceAccount used by the pods of the workload.
+type ServiceAccountSourceSettings struct {
+	// Precedence defines whether the values of the `namespace` (default) or
+	// of the `serviceAccount` win when both define the same label.
+	Precedence string `json:"precedence,omitempty"`
+}
+
+func (s *ServiceAccountSourceSettings) Valid() error {
+	switch s.Precedence {
+	case "", SERVICE_ACCOUNT_PRECEDENCE_NAMESPACE, SERVICE_ACCOUNT_PRECEDENCE_SERVICE_ACCOUNT:
+	default:
+		return fmt.Errorf("serviceAccount precedence must be either %q or %q", SERVICE_ACCOUNT_PRECEDENCE_NAMESPACE, SERVICE_ACCOUNT_PRECEDENCE_SERVICE_ACCOUNT)
+	}
+	return nil
+}
+
+// serviceAccountName returns the name of the ServiceAccount used by the pods
+// of the workload. Pods not defining it use the `default` ServiceAccount.
+// Returns `false` when the workload has no pod spec.
+func serviceAccountName(validationRequest kubewarden_protocol.ValidationRequest) (string, bool, error) {
+	path, supported := podSpecPaths[requestGVK(validationRequest.Request)]
+	if !supported {
+		return "", false, nil
+	}
+	object, err := decodeObject(validationRequest.Request.Object)
+	if err != nil {
+		return "", false, err
+	}
+	podSpec, found := nestedMap(object, path...)
+	if !found {
+		return "", false, nil
+	}
+	name, _ := podSpec["serviceAccountName"].(string)
+	if name == "" {
+		// `serviceAccount` is the deprecated alias of `serviceAccountName`
+		name, _ = podSpec["serviceAccount"].(string)
+	}
+	if name == "" {
+		name = DEFAULT_SERVICE_ACCOUNT_NAME
+	}
+	return name, true, nil
+}
+
+// serviceAccountLabels returns the propagation candidates defined by the
+// ServiceAccount used by the pods of the workload. Missing ServiceAccounts
+// have no candidates.
+func serviceAccountLabels(validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	if settings.ServiceAccount == nil {
+		return nil, nil
+	}
+
+	name, found, err := serviceAccountName(validationRequest)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	namespace := validationRequest.Request.Namespace
+	serviceAccount := corev1.ServiceAccount{}
+	err = fetchResource("v1", "ServiceAccount", name, &namespace, settings.cacheDisabled(validationRequest.Request.Operation), &serviceAccount)
+	if isLookupNotFound(err) {
+		logger.WarnWith("service account not found").
+			String("uid", validationRequest.Request.Uid).
+			String("namespace", namespace).
+			String("serviceAccount", name).
+			Write()
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if serviceAccount.Metadata == nil {
+		return nil, &lookupError{Reason: LOOKUP_INVALID, Err: errors.New("cannot parse serviceaccount data: metadata is missing")}
+	}
+	return serviceAccount.Metadata.Labels, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	appsv1 "github.com/kubewarden/k8s-objects/api/apps/v1"
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// mockServiceAccount configures the given client to answer the lookup of
+// the given ServiceAccount of the test namespace. Nil labels are reported as
+// a missing ServiceAccount.
+func mockServiceAccount(t *testing.T, wapcClient *mocks.MockWapcClient, name string, labels map[string]string) {
+	namespace := TEST_NAMESPACE
+	request := kubernetes.GetResourceRequest{APIVersion: "v1", Kind: "ServiceAccount", Name: name, Namespace: &namespace}
+	if labels == nil {
+		mockGetResource(t, wapcClient, request, nil, errors.New(`serviceaccounts "`+name+`" not found: NotFound`))
+		return
+	}
+	mockGetResource(t, wapcClient, request, corev1.ServiceAccount{Metadata: &metav1.ObjectMeta{Name: name, Labels: labels}}, nil)
+}
+
+func TestServiceAccountLabels(t *testing.T) {
+	cases := []struct {
+		name           string
+		resource       interface{}
+		kind           kubewarden_protocol.GroupVersionKind
+		serviceAccount string
+		labels         map[string]string
+		expectedLabels map[string]string
+	}{
+		{
+			"pod service account",
+			corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test"}, Spec: &corev1.PodSpec{ServiceAccountName: "payments"}},
+			POD_KIND,
+			"payments",
+			map[string]string{"security-tier": "high"},
+			map[string]string{"security-tier": "high"},
+		},
+		{
+			"default service account",
+			corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test"}, Spec: &corev1.PodSpec{}},
+			POD_KIND,
+			"default",
+			map[string]string{"security-tier": "low"},
+			map[string]string{"security-tier": "low"},
+		},
+		{
+			"pod template service account",
+			appsv1.Deployment{
+				Metadata: &metav1.ObjectMeta{Name: "test"},
+				Spec: &appsv1.DeploymentSpec{Template: &corev1.PodTemplateSpec{
+					Spec: &corev1.PodSpec{ServiceAccountName: "payments"},
+				}},
+			},
+			DEPLOYMENT_KIND,
+			"payments",
+			map[string]string{"security-tier": "high"},
+			map[string]string{"security-tier": "high"},
+		},
+		{
+			"missing service account",
+			corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test"}, Spec: &corev1.PodSpec{ServiceAccountName: "payments"}},
+			POD_KIND,
+			"payments",
+			nil,
+			map[string]string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"security-tier"}, ServiceAccount: &ServiceAccountSourceSettings{}}
+			payload, err := buildValidationRequest(settings.PropagatedLabels, tc.resource, tc.kind)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			validationRequest := kubewarden_protocol.ValidationRequest{}
+			if err := json.Unmarshal(payload, &validationRequest); err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			wapcClient := mocks.NewMockWapcClient(t)
+			mockServiceAccount(t, wapcClient, tc.serviceAccount, tc.labels)
+			host.Client = wapcClient
+
+			labels, err := serviceAccountLabels(validationRequest, settings)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestServiceAccountLabelsPrecedence(t *testing.T) {
+	cases := []struct {
+		precedence     string
+		expectedLabels map[string]string
+	}{
+		{"", map[string]string{"security-tier": "namespace", "data-classification": "pii"}},
+		{SERVICE_ACCOUNT_PRECEDENCE_SERVICE_ACCOUNT, map[string]string{"security-tier": "service-account", "data-classification": "pii"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.precedence, func(t *testing.T) {
+			resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}, Spec: &corev1.PodSpec{ServiceAccountName: "payments"}}
+			payload, err := buildValidationRequest([]string{"security-tier", "data-classification"}, resource, POD_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.ServiceAccount = &ServiceAccountSourceSettings{Precedence: tc.precedence}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			wapcClient := mockNamespaceLabels(t, map[string]string{"security-tier": "namespace"})
+			mockServiceAccount(t, wapcClient, "payments", map[string]string{"security-tier": "service-account", "data-classification": "pii"})
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			labels, err := mutatedPodLabels(responsePayload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
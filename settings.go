@@ -4,20 +4,138 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	kubewarden "github.com/kubewarden/policy-sdk-go"
 	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
 )
 
+const (
+	UNSUPPORTED_KINDS_REJECT = "reject"
+	UNSUPPORTED_KINDS_IGNORE = "ignore"
+
+	FAILURE_POLICY_FAIL_OPEN   = "fail-open"
+	FAILURE_POLICY_FAIL_CLOSED = "fail-closed"
+
+	DEFAULT_NAMESPACE_HIERARCHY_MAX_DEPTH = 5
+)
+
+// admissionOperations lists the operations of the admission requests
+var admissionOperations = []string{"CREATE", "UPDATE", "DELETE", "CONNECT"}
+
 type Settings struct {
 	PropagatedLabels []string `json:"propagatedLabels"`
+	// UnsupportedKinds defines what to do with the requests of kinds not
+	// handled by the policy. Requests are rejected by default.
+	UnsupportedKinds string `json:"unsupportedKinds,omitempty"`
+	// FailurePolicy defines what to do when the namespace of the request
+	// cannot be fetched. Requests are rejected by default.
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// DisableCache disables the cache of the host for all the resources
+	// fetched by the policy.
+	DisableCache bool `json:"disableCache,omitempty"`
+	// DisableCacheOperations disables the cache of the host only for the
+	// requests with one of the given operations.
+	DisableCacheOperations []string `json:"disableCacheOperations,omitempty"`
+	// ExemptUsernames, ExemptGroups and ExemptServiceAccounts list the users
+	// whose requests are accepted without changes. Service accounts are
+	// defined using the `<namespace>:<name>` format.
+	ExemptUsernames       []string `json:"exemptUsernames,omitempty"`
+	ExemptGroups          []string `json:"exemptGroups,omitempty"`
+	ExemptServiceAccounts []string `json:"exemptServiceAccounts,omitempty"`
+	// WorkloadOverrides enables the annotations used by the workloads to opt
+	// out of propagated labels or to override their values.
+	WorkloadOverrides *WorkloadOverridesSettings `json:"workloadOverrides,omitempty"`
+	// NamespaceHierarchy enables the propagation of the labels defined by
+	// the ancestors of the namespace.
+	NamespaceHierarchy *NamespaceHierarchySettings `json:"namespaceHierarchy,omitempty"`
+	// RancherProject enables the propagation of the metadata of the Rancher
+	// Project the namespace belongs to.
+	RancherProject *RancherProjectSettings `json:"rancherProject,omitempty"`
+	// ReferencedResources lists the objects referenced by the namespace
+	// whose labels are propagation candidates.
+	ReferencedResources []ReferencedResourceSettings `json:"referencedResources,omitempty"`
+	// ConfigMap enables the propagation of the label values defined by a
+	// ConfigMap.
+	ConfigMap *ConfigMapSourceSettings `json:"configMap,omitempty"`
+	// ServiceAccount enables the propagation of the labels of the
+	// ServiceAccount used by the pods of the workload.
+	ServiceAccount *ServiceAccountSourceSettings `json:"serviceAccount,omitempty"`
+	// PropagatedAnnotations lists the namespace annotations whose values are
+	// set as labels of the workloads.
+	PropagatedAnnotations []PropagatedAnnotationSettings `json:"propagatedAnnotations,omitempty"`
+	// SyntheticLabels lists the labels whose values are derived from the
+	// namespace metadata, like its name or UID.
+	SyntheticLabels []SyntheticLabelSettings `json:"syntheticLabels,omitempty"`
+	// StaticLabels defines labels, and their values, set on all the
+	// workloads whatever their namespace.
+	StaticLabels map[string]string `json:"staticLabels,omitempty"`
+	// StaticLabelsPrecedence defines whether the values of the namespace
+	// (default) or the static ones win when both define the same label.
+	StaticLabelsPrecedence string `json:"staticLabelsPrecedence,omitempty"`
+	// ContainerEnv enables the injection of namespace label values as
+	// environment variables of the containers.
+	ContainerEnv *ContainerEnvSettings `json:"containerEnv,omitempty"`
+	// Scheduling enables the node selector entries, and the tolerations,
+	// derived from the namespace labels.
+	Scheduling *SchedulingSettings `json:"scheduling,omitempty"`
+	// PodDefaults maps the values of the namespace labels to the values of
+	// pod spec fields, used when the fields are not set.
+	PodDefaults []PodDefaultsRule `json:"podDefaults,omitempty"`
+	// NamespaceDefaults enables the labels set on the namespaces when they
+	// are created.
+	NamespaceDefaults *NamespaceDefaultsSettings `json:"namespaceDefaults,omitempty"`
+	// NamespaceValidation enables the validation of the namespace labels
+	// when the namespaces are created or updated.
+	NamespaceValidation *NamespaceValidationSettings `json:"namespaceValidation,omitempty"`
+	// LabelValues restricts the values of the propagated labels.
+	LabelValues []LabelValueSettings `json:"labelValues,omitempty"`
+	// NamespaceProtection enables the permission check done when the
+	// propagated labels of a namespace are changed.
+	NamespaceProtection *NamespaceProtectionSettings `json:"namespaceProtection,omitempty"`
+	// ReportNamespaceImpact enables the logging of the number of resources
+	// whose propagated labels are outdated by a namespace update. All the
+	// workloads of the namespace are listed while the update waits for the
+	// policy response, which can be slow on large namespaces.
+	ReportNamespaceImpact bool `json:"reportNamespaceImpact,omitempty"`
+	// OnCreateOnly lists the propagated labels set only when the resources
+	// are created. Updates keep the value the resource already has.
+	OnCreateOnly []string `json:"onCreateOnly,omitempty"`
+}
+
+// NamespaceHierarchySettings defines how the parent of a namespace is found.
+// The parent name is read from either an annotation or a label of the
+// namespace.
+type NamespaceHierarchySettings struct {
+	Annotation string `json:"annotation,omitempty"`
+	Label      string `json:"label,omitempty"`
+	// MaxDepth is the maximum number of ancestors visited. Defaults to 5.
+	MaxDepth int `json:"maxDepth,omitempty"`
+}
+
+func (h *NamespaceHierarchySettings) Valid() error {
+	if (h.Annotation == "") == (h.Label == "") {
+		return errors.New("namespaceHierarchy requires either annotation or label")
+	}
+	if h.MaxDepth < 0 {
+		return errors.New("namespaceHierarchy maxDepth cannot be negative")
+	}
+	return nil
+}
+
+func (h *NamespaceHierarchySettings) maxDepth() int {
+	if h.MaxDepth == 0 {
+		return DEFAULT_NAMESPACE_HIERARCHY_MAX_DEPTH
+	}
+	return h.MaxDepth
 }
 
 // The Settings class is defined inside of the `types.go` file
 
 // No special checks have to be done
 func (s *Settings) Valid() (bool, error) {
-	if len(s.PropagatedLabels) == 0 {
+	if len(s.propagatedLabelKeys()) == 0 && s.ContainerEnv == nil && s.Scheduling == nil && len(s.PodDefaults) == 0 {
 		return false, errors.New("some label must be provided")
 	}
 	for _, label := range s.PropagatedLabels {
@@ -25,9 +143,144 @@ func (s *Settings) Valid() (bool, error) {
 			return false, errors.New("empty labels are not allowed")
 		}
 	}
+	switch s.UnsupportedKinds {
+	case "", UNSUPPORTED_KINDS_REJECT, UNSUPPORTED_KINDS_IGNORE:
+	default:
+		return false, fmt.Errorf("unsupportedKinds must be either %q or %q", UNSUPPORTED_KINDS_REJECT, UNSUPPORTED_KINDS_IGNORE)
+	}
+	switch s.FailurePolicy {
+	case "", FAILURE_POLICY_FAIL_OPEN, FAILURE_POLICY_FAIL_CLOSED:
+	default:
+		return false, fmt.Errorf("failurePolicy must be either %q or %q", FAILURE_POLICY_FAIL_OPEN, FAILURE_POLICY_FAIL_CLOSED)
+	}
+	for _, operation := range s.DisableCacheOperations {
+		if !slices.Contains(admissionOperations, operation) {
+			return false, fmt.Errorf("disableCacheOperations contains an invalid operation %q, valid operations are: %s", operation, strings.Join(admissionOperations, ", "))
+		}
+	}
+	if err := s.validateExemptions(); err != nil {
+		return false, err
+	}
+	if err := s.validateStaticLabels(); err != nil {
+		return false, err
+	}
+	if s.WorkloadOverrides != nil {
+		if err := s.WorkloadOverrides.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.NamespaceHierarchy != nil {
+		if err := s.NamespaceHierarchy.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.RancherProject != nil {
+		if err := s.RancherProject.Valid(); err != nil {
+			return false, err
+		}
+	}
+	for _, reference := range s.ReferencedResources {
+		if err := reference.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.ConfigMap != nil {
+		if err := s.ConfigMap.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.ServiceAccount != nil {
+		if err := s.ServiceAccount.Valid(); err != nil {
+			return false, err
+		}
+	}
+	for _, rule := range s.PropagatedAnnotations {
+		if err := rule.Valid(); err != nil {
+			return false, err
+		}
+	}
+	for _, rule := range s.SyntheticLabels {
+		if err := rule.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.ContainerEnv != nil {
+		if err := s.ContainerEnv.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.Scheduling != nil {
+		if err := s.Scheduling.Valid(); err != nil {
+			return false, err
+		}
+	}
+	for _, rule := range s.PodDefaults {
+		if err := rule.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.NamespaceDefaults != nil {
+		if err := s.NamespaceDefaults.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.NamespaceValidation != nil {
+		if err := s.NamespaceValidation.Valid(); err != nil {
+			return false, err
+		}
+	}
+	if s.NamespaceProtection != nil {
+		if err := s.NamespaceProtection.Valid(); err != nil {
+			return false, err
+		}
+	}
+	for i, rule := range s.LabelValues {
+		if err := rule.Valid(); err != nil {
+			return false, err
+		}
+		if slices.ContainsFunc(s.LabelValues[:i], func(other LabelValueSettings) bool { return other.Label == rule.Label }) {
+			return false, fmt.Errorf("labelValues: label %s is defined more than once", rule.Label)
+		}
+	}
+	for _, label := range s.OnCreateOnly {
+		if !slices.Contains(s.propagatedLabelKeys(), label) {
+			return false, fmt.Errorf("onCreateOnly: label %q is not propagated", label)
+		}
+	}
 	return true, nil
 }
 
+// propagatedLabelKeys returns the keys of all the labels propagated by the
+// policy: the ones listed in `propagatedLabels` and the ones obtained from
+// the namespace annotations and metadata, and the static ones.
+func (s *Settings) propagatedLabelKeys() []string {
+	keys := slices.Clone(s.PropagatedLabels)
+	for _, rule := range s.PropagatedAnnotations {
+		if !slices.Contains(keys, rule.Label) {
+			keys = append(keys, rule.Label)
+		}
+	}
+	for _, rule := range s.SyntheticLabels {
+		if !slices.Contains(keys, rule.Label) {
+			keys = append(keys, rule.Label)
+		}
+	}
+	staticKeys := make([]string, 0, len(s.StaticLabels))
+	for key := range s.StaticLabels {
+		if !slices.Contains(keys, key) {
+			staticKeys = append(staticKeys, key)
+		}
+	}
+	slices.Sort(staticKeys)
+	return append(keys, staticKeys...)
+}
+
+// cacheDisabled returns `true` when the resources fetched while processing a
+// request with the given operation must bypass the cache of the host.
+func (s *Settings) cacheDisabled(operation string) bool {
+	return s.DisableCache || slices.Contains(s.DisableCacheOperations, operation)
+}
+
 func NewSettingsFromValidationReq(validationReq *kubewarden_protocol.ValidationRequest) (Settings, error) {
 	settings := Settings{}
 	err := json.Unmarshal(validationReq.Settings, &settings)
@@ -55,3 +55,127 @@ func TestParsingSettingsWithNoLabels(t *testing.T) {
 		t.Errorf("At least one label must be provided")
 	}
 }
+
+func TestParsingSettingsWithUnsupportedKinds(t *testing.T) {
+	cases := []struct {
+		unsupportedKinds string
+		valid            bool
+	}{
+		{"", true},
+		{"reject", true},
+		{"ignore", true},
+		{"drop", false},
+	}
+
+	for _, tc := range cases {
+		rawSettings := []byte(`{"propagatedLabels": ["label"], "unsupportedKinds": "` + tc.unsupportedKinds + `"}`)
+		settings := &Settings{}
+		if err := json.Unmarshal(rawSettings, settings); err != nil {
+			t.Errorf("Unexpected error %+v", err)
+		}
+
+		valid, _ := settings.Valid()
+		if valid != tc.valid {
+			t.Errorf("unsupportedKinds %q: expected valid to be %t", tc.unsupportedKinds, tc.valid)
+		}
+	}
+}
+
+func TestParsingSettingsWithFailurePolicy(t *testing.T) {
+	cases := []struct {
+		failurePolicy string
+		valid         bool
+	}{
+		{"", true},
+		{"fail-open", true},
+		{"fail-closed", true},
+		{"ignore", false},
+	}
+
+	for _, tc := range cases {
+		rawSettings := []byte(`{"propagatedLabels": ["label"], "failurePolicy": "` + tc.failurePolicy + `"}`)
+		settings := &Settings{}
+		if err := json.Unmarshal(rawSettings, settings); err != nil {
+			t.Errorf("Unexpected error %+v", err)
+		}
+
+		valid, _ := settings.Valid()
+		if valid != tc.valid {
+			t.Errorf("failurePolicy %q: expected valid to be %t", tc.failurePolicy, tc.valid)
+		}
+	}
+}
+
+func TestParsingSettingsWithDisableCacheOperations(t *testing.T) {
+	rawSettings := []byte(`{"propagatedLabels": ["label"], "disableCacheOperations": ["CREATE"]}`)
+	settings := &Settings{}
+	if err := json.Unmarshal(rawSettings, settings); err != nil {
+		t.Errorf("Unexpected error %+v", err)
+	}
+	if valid, err := settings.Valid(); !valid {
+		t.Errorf("Settings should be valid: %+v", err)
+	}
+	if !settings.cacheDisabled("CREATE") || settings.cacheDisabled("UPDATE") {
+		t.Errorf("Cache should be disabled only for CREATE operations")
+	}
+
+	rawSettings = []byte(`{"propagatedLabels": ["label"], "disableCacheOperations": ["create"]}`)
+	settings = &Settings{}
+	if err := json.Unmarshal(rawSettings, settings); err != nil {
+		t.Errorf("Unexpected error %+v", err)
+	}
+	if valid, _ := settings.Valid(); valid {
+		t.Errorf("Unknown operations should not be valid")
+	}
+}
+
+func TestParsingSettingsWithNamespaceHierarchy(t *testing.T) {
+	cases := []struct {
+		hierarchy string
+		valid     bool
+	}{
+		{`{"annotation": "hnc.x-k8s.io/subnamespace-of"}`, true},
+		{`{"label": "parent", "maxDepth": 2}`, true},
+		{`{}`, false},
+		{`{"annotation": "parent", "label": "parent"}`, false},
+		{`{"label": "parent", "maxDepth": -1}`, false},
+	}
+
+	for _, tc := range cases {
+		rawSettings := []byte(`{"propagatedLabels": ["label"], "namespaceHierarchy": ` + tc.hierarchy + `}`)
+		settings := &Settings{}
+		if err := json.Unmarshal(rawSettings, settings); err != nil {
+			t.Errorf("Unexpected error %+v", err)
+		}
+
+		valid, _ := settings.Valid()
+		if valid != tc.valid {
+			t.Errorf("namespaceHierarchy %s: expected valid to be %t", tc.hierarchy, tc.valid)
+		}
+	}
+}
+
+func TestParsingSettingsWithRancherProject(t *testing.T) {
+	cases := []struct {
+		rancherProject string
+		valid          bool
+	}{
+		{`{}`, true},
+		{`{"metadata": "labels", "clusterName": "c-abc"}`, true},
+		{`{"metadata": "annotations"}`, true},
+		{`{"metadata": "spec"}`, false},
+	}
+
+	for _, tc := range cases {
+		rawSettings := []byte(`{"propagatedLabels": ["label"], "rancherProject": ` + tc.rancherProject + `}`)
+		settings := &Settings{}
+		if err := json.Unmarshal(rawSettings, settings); err != nil {
+			t.Errorf("Unexpected error %+v", err)
+		}
+
+		valid, _ := settings.Valid()
+		if valid != tc.valid {
+			t.Errorf("rancherProject %s: expected valid to be %t", tc.rancherProject, tc.valid)
+		}
+	}
+}
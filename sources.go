@@ -0,0 +1,75 @@
+package main
+
+import (
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
+)
+
+// propagationCandidates returns the labels, and their values, that can be
+// propagated to the workload. Only the ones listed in the settings are then
+// propagated. When more sources define the same label, the value is taken
+// from the first source defining it, in this order:
+//
+//   - the static labels, when they take precedence over the namespace
+//   - the ConfigMap, when it takes precedence over the namespace
+//   - the ServiceAccount, when it takes precedence over the namespace
+//   - the namespace annotations listed in the settings
+//   - the labels derived from the namespace metadata
+//   - the namespace, and its ancestors
+//   - the Rancher Project of the namespace
+//   - the resources referenced by the namespace
+//   - the ServiceAccount, when the namespace takes precedence over it
+//   - the ConfigMap, when the namespace takes precedence over it
+//   - the static labels, when the namespace takes precedence over them
+func propagationCandidates(namespace *corev1.Namespace, validationRequest kubewarden_protocol.ValidationRequest, settings Settings) (map[string]string, error) {
+	configMapCandidates, err := configMapLabels(validationRequest, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceAccountCandidates, err := serviceAccountLabels(validationRequest, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]string)
+	if settings.StaticLabelsPrecedence == STATIC_LABELS_PRECEDENCE_STATIC {
+		mergeMissingLabels(candidates, settings.StaticLabels)
+	}
+	if settings.ConfigMap != nil && settings.ConfigMap.Precedence == CONFIGMAP_PRECEDENCE_CONFIGMAP {
+		mergeMissingLabels(candidates, configMapCandidates)
+	}
+	if settings.ServiceAccount != nil && settings.ServiceAccount.Precedence == SERVICE_ACCOUNT_PRECEDENCE_SERVICE_ACCOUNT {
+		mergeMissingLabels(candidates, serviceAccountCandidates)
+	}
+
+	annotationLabels, err := namespaceAnnotationLabels(namespace, settings)
+	if err != nil {
+		return nil, err
+	}
+	mergeMissingLabels(candidates, annotationLabels)
+	mergeMissingLabels(candidates, syntheticLabels(namespace, settings))
+
+	labels, err := namespaceLabels(namespace, validationRequest, settings)
+	if err != nil {
+		return nil, err
+	}
+	mergeMissingLabels(candidates, labels)
+
+	projectLabels, err := rancherProjectLabels(namespace, validationRequest, settings)
+	if err != nil {
+		return nil, err
+	}
+	mergeMissingLabels(candidates, projectLabels)
+
+	referencedLabels, err := referencedResourcesLabels(namespace, validationRequest, settings)
+	if err != nil {
+		return nil, err
+	}
+	mergeMissingLabels(candidates, referencedLabels)
+
+	mergeMissingLabels(candidates, serviceAccountCandidates)
+	mergeMissingLabels(candidates, configMapCandidates)
+	mergeMissingLabels(candidates, settings.StaticLabels)
+	return candidates, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	STATIC_LABELS_PRECEDENCE_NAMESPACE = "namespace"
+	STATIC_LABELS_PRECEDENCE_STATIC    = "static"
+)
+
+func (s *Settings) validateStaticLabels() error {
+	keys := make([]string, 0, len(s.StaticLabels))
+	for key := range s.StaticLabels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if err := validateLabelKey(key); err != nil {
+			return fmt.Errorf("staticLabels: %w", err)
+		}
+		if err := validateLabelValue(s.StaticLabels[key]); err != nil {
+			return fmt.Errorf("staticLabels %s: %w", key, err)
+		}
+	}
+	switch s.StaticLabelsPrecedence {
+	case "", STATIC_LABELS_PRECEDENCE_NAMESPACE, STATIC_LABELS_PRECEDENCE_STATIC:
+	default:
+		return fmt.Errorf("staticLabelsPrecedence must be either %q or %q", STATIC_LABELS_PRECEDENCE_NAMESPACE, STATIC_LABELS_PRECEDENCE_STATIC)
+	}
+	return nil
+}
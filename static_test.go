@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	appsv1 "github.com/kubewarden/k8s-objects/api/apps/v1"
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStaticLabelsArePropagated(t *testing.T) {
+	cases := []struct {
+		name           string
+		precedence     string
+		expectedLabels map[string]string
+	}{
+		{"namespace wins by default", "", map[string]string{"cluster": "prod-eu-1", "environment": "staging"}},
+		{"namespace wins", STATIC_LABELS_PRECEDENCE_NAMESPACE, map[string]string{"cluster": "prod-eu-1", "environment": "staging"}},
+		{"static wins", STATIC_LABELS_PRECEDENCE_STATIC, map[string]string{"cluster": "prod-eu-1", "environment": "production"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource := appsv1.Deployment{
+				Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE},
+				Spec: &appsv1.DeploymentSpec{
+					Template: &corev1.PodTemplateSpec{Metadata: &metav1.ObjectMeta{}},
+				},
+			}
+			payload, err := buildValidationRequest(nil, resource, DEPLOYMENT_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.StaticLabels = map[string]string{"cluster": "prod-eu-1", "environment": "production"}
+				settings.StaticLabelsPrecedence = tc.precedence
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			mockNamespaceLabels(t, map[string]string{"environment": "staging", "team": "a"})
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, SHOULD_MUTATE)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			mutatedResourceJSON, err := json.Marshal(response.MutatedObject)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			deployment := appsv1.Deployment{}
+			if err := json.Unmarshal(mutatedResourceJSON, &deployment); err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(deployment.Metadata.Labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+			if err := validateLabels(deployment.Spec.Template.Metadata.Labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+		})
+	}
+}
+
+func TestStaticLabelsSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name       string
+		labels     map[string]string
+		precedence string
+		valid      bool
+	}{
+		{"valid labels", map[string]string{"example.com/cluster": "prod-eu-1"}, STATIC_LABELS_PRECEDENCE_STATIC, true},
+		{"invalid key", map[string]string{"not a label": "prod-eu-1"}, "", false},
+		{"invalid value", map[string]string{"cluster": "prod eu 1"}, "", false},
+		{"invalid precedence", map[string]string{"cluster": "prod-eu-1"}, "cluster", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{StaticLabels: tc.labels, StaticLabelsPrecedence: tc.precedence}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
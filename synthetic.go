@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+)
+
+const (
+	SYNTHETIC_SOURCE_NAMESPACE_NAME          = "namespace.name"
+	SYNTHETIC_SOURCE_NAMESPACE_UID           = "namespace.uid"
+	SYNTHETIC_SOURCE_NAMESPACE_CREATION_DATE = "namespace.creationDate"
+)
+
+// SyntheticLabelSettings defines a label whose value is derived from the
+// metadata of the namespace, instead of being read from its labels.
+type SyntheticLabelSettings struct {
+	Source string `json:"source"`
+	Label  string `json:"label"`
+}
+
+func (s *SyntheticLabelSettings) Valid() error {
+	switch s.Source {
+	case SYNTHETIC_SOURCE_NAMESPACE_NAME, SYNTHETIC_SOURCE_NAMESPACE_UID, SYNTHETIC_SOURCE_NAMESPACE_CREATION_DATE:
+	default:
+		return fmt.Errorf("syntheticLabels source must be one of %q, %q or %q. Found %q", SYNTHETIC_SOURCE_NAMESPACE_NAME, SYNTHETIC_SOURCE_NAMESPACE_UID, SYNTHETIC_SOURCE_NAMESPACE_CREATION_DATE, s.Source)
+	}
+	if err := validateLabelKey(s.Label); err != nil {
+		return fmt.Errorf("syntheticLabels entry %s: %w", s.Source, err)
+	}
+	return nil
+}
+
+// syntheticValue returns the value of the given source, read from the
+// namespace metadata. Returns `false` when the namespace does not define it.
+func syntheticValue(namespace *corev1.Namespace, source string) (string, bool) {
+	switch source {
+	case SYNTHETIC_SOURCE_NAMESPACE_NAME:
+		return namespace.Metadata.Name, namespace.Metadata.Name != ""
+	case SYNTHETIC_SOURCE_NAMESPACE_UID:
+		return namespace.Metadata.UID, namespace.Metadata.UID != ""
+	case SYNTHETIC_SOURCE_NAMESPACE_CREATION_DATE:
+		if namespace.Metadata.CreationTimestamp == nil {
+			return "", false
+		}
+		return time.Time(*namespace.Metadata.CreationTimestamp).UTC().Format(time.DateOnly), true
+	}
+	return "", false
+}
+
+// syntheticLabels returns the labels derived from the namespace metadata, as
+// defined by the `syntheticLabels` settings.
+func syntheticLabels(namespace *corev1.Namespace, settings Settings) map[string]string {
+	labels := make(map[string]string)
+	for _, rule := range settings.SyntheticLabels {
+		value, found := syntheticValue(namespace, rule.Source)
+		if !found {
+			continue
+		}
+		labels[rule.Label] = value
+	}
+	return labels
+}
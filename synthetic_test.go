@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
+	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
+	"github.com/kubewarden/policy-sdk-go/pkg/capabilities/mocks"
+)
+
+func TestSyntheticLabels(t *testing.T) {
+	creationTimestamp := metav1.Time(time.Date(2024, time.March, 7, 23, 30, 0, 0, time.FixedZone("CET", 3600)))
+	namespace := &corev1.Namespace{Metadata: &metav1.ObjectMeta{
+		Name:              TEST_NAMESPACE,
+		UID:               "6a4b0e6c-2a8d-4bb1-9d47-2f3d8f3f1c2e",
+		CreationTimestamp: &creationTimestamp,
+	}}
+
+	settings := Settings{SyntheticLabels: []SyntheticLabelSettings{
+		{Source: SYNTHETIC_SOURCE_NAMESPACE_NAME, Label: "namespace"},
+		{Source: SYNTHETIC_SOURCE_NAMESPACE_UID, Label: "namespace-uid"},
+		{Source: SYNTHETIC_SOURCE_NAMESPACE_CREATION_DATE, Label: "namespace-created"},
+	}}
+	labels := syntheticLabels(namespace, settings)
+	expectedLabels := map[string]string{
+		"namespace":         TEST_NAMESPACE,
+		"namespace-uid":     "6a4b0e6c-2a8d-4bb1-9d47-2f3d8f3f1c2e",
+		"namespace-created": "2024-03-07",
+	}
+	if err := validateLabels(labels, expectedLabels); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSyntheticLabelsSkipMissingMetadata(t *testing.T) {
+	namespace := &corev1.Namespace{Metadata: &metav1.ObjectMeta{Name: TEST_NAMESPACE}}
+	settings := Settings{SyntheticLabels: []SyntheticLabelSettings{
+		{Source: SYNTHETIC_SOURCE_NAMESPACE_UID, Label: "namespace-uid"},
+		{Source: SYNTHETIC_SOURCE_NAMESPACE_CREATION_DATE, Label: "namespace-created"},
+	}}
+	if labels := syntheticLabels(namespace, settings); len(labels) != 0 {
+		t.Errorf("Expected no label, found: %v", labels)
+	}
+}
+
+func TestSyntheticLabelsArePropagated(t *testing.T) {
+	resource := corev1.Pod{Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE}}
+	payload, err := buildValidationRequest(nil, resource, POD_KIND)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+		settings.PropagatedLabels = nil
+		settings.SyntheticLabels = []SyntheticLabelSettings{{Source: SYNTHETIC_SOURCE_NAMESPACE_NAME, Label: "namespace"}}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	namespace := &corev1.Namespace{Metadata: &metav1.ObjectMeta{
+		Name:   TEST_NAMESPACE,
+		Labels: map[string]string{"namespace": "label-value"},
+	}}
+	wapcClient := mocks.NewMockWapcClient(t)
+	mockNamespaces(t, wapcClient, map[string]*corev1.Namespace{TEST_NAMESPACE: namespace})
+	host.Client = wapcClient
+
+	responsePayload, err := validate(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	labels, err := mutatedPodLabels(responsePayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if err := validateLabels(labels, map[string]string{"namespace": TEST_NAMESPACE}); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSyntheticLabelsSettingsValidation(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  SyntheticLabelSettings
+		valid bool
+	}{
+		{"valid rule", SyntheticLabelSettings{Source: SYNTHETIC_SOURCE_NAMESPACE_CREATION_DATE, Label: "namespace-created"}, true},
+		{"unknown source", SyntheticLabelSettings{Source: "namespace.owner", Label: "owner"}, false},
+		{"invalid label", SyntheticLabelSettings{Source: SYNTHETIC_SOURCE_NAMESPACE_NAME, Label: "not a label"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{SyntheticLabels: []SyntheticLabelSettings{tc.rule}}
+			valid, _ := settings.Valid()
+			if valid != tc.valid {
+				t.Errorf("Expected valid to be %t", tc.valid)
+			}
+		})
+	}
+}
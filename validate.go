@@ -2,165 +2,170 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
-	"strings"
+	"errors"
+	"slices"
 
-	appsv1 "github.com/kubewarden/k8s-objects/api/apps/v1"
-	batchv1 "github.com/kubewarden/k8s-objects/api/batch/v1"
-	corev1 "github.com/kubewarden/k8s-objects/api/core/v1"
-	metav1 "github.com/kubewarden/k8s-objects/apimachinery/pkg/apis/meta/v1"
 	kubewarden "github.com/kubewarden/policy-sdk-go"
 	"github.com/kubewarden/policy-sdk-go/pkg/capabilities"
-	kubernetes "github.com/kubewarden/policy-sdk-go/pkg/capabilities/kubernetes"
 	kubewarden_protocol "github.com/kubewarden/policy-sdk-go/protocol"
 )
 
-const (
-	DEPLOYMENT_KIND            = "deployment"
-	REPLICASET_KIND            = "replicaset"
-	STATEFULSET_KIND           = "statefulset"
-	DAEMONSET_KIND             = "daemonset"
-	REPLICATIONCONTROLLER_KIND = "replicationcontroller"
-	CRONJOB_KIND               = "cronjob"
-	JOB_KIND                   = "job"
-	POD_KIND                   = "pod"
-)
-
 var host = capabilities.NewHost()
 
-func getNamespace(validationRequest kubewarden_protocol.ValidationRequest) (*corev1.Namespace, error) {
-	if len(validationRequest.Request.Namespace) == 0 {
-		return nil, fmt.Errorf("admission request is missing namespace")
-	}
+// rejectionError is an error that causes the rejection of the request with
+// the given code.
+type rejectionError struct {
+	Code kubewarden.Code
+	Err  error
+}
 
-	resourceRequest := kubernetes.GetResourceRequest{
-		APIVersion: "v1",
-		Kind:       "Namespace",
-		Name:       validationRequest.Request.Namespace,
-	}
+func (e *rejectionError) Error() string {
+	return e.Err.Error()
+}
 
-	responseBytes, err := kubernetes.GetResource(&host, resourceRequest)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get namespace data: %s", err)
-	}
-	namespace := &corev1.Namespace{}
-	if err := json.Unmarshal(responseBytes, namespace); err != nil {
-		return nil, fmt.Errorf("cannot parse namespace data: %s", err)
+func (e *rejectionError) Unwrap() error {
+	return e.Err
+}
+
+// rejectWithError rejects the request using the error message. The code is
+// taken from the error when available, otherwise 400 is used.
+func rejectWithError(err error) ([]byte, error) {
+	code := kubewarden.Code(400)
+	rejection := &rejectionError{}
+	if errors.As(err, &rejection) {
+		code = rejection.Code
 	}
-	return namespace, nil
+	return kubewarden.RejectRequest(kubewarden.Message(err.Error()), code)
 }
 
 func validateResourceLabels(namespaceLabels map[string]string, request kubewarden_protocol.ValidationRequest, settings Settings) ([]byte, error) {
 	labelsToPropagate := make(map[string]string)
-	for _, label := range settings.PropagatedLabels {
+	for _, label := range settings.propagatedLabelKeys() {
 		if value, namespace_has_label := namespaceLabels[label]; namespace_has_label {
 			labelsToPropagate[label] = value
 		}
 	}
-	return updateResourceLabels(request, labelsToPropagate)
-}
 
-// propagateLabels ensures the labels defined in the meta object contains the
-// same labels defined in the `labelsToPropagate` map. Returns `true` when
-// the meta object has been changed
-func propagateLabels(meta *metav1.ObjectMeta, labelsToPropagate map[string]string) bool {
-	if meta.Labels == nil {
-		meta.Labels = make(map[string]string)
+	var mutations []objectMutation
+	if settings.WorkloadOverrides != nil {
+		overrides, err := getWorkloadOverrides(request.Request, settings)
+		if err != nil {
+			return rejectWithError(err)
+		}
+		labelsToPropagate = overrides.apply(labelsToPropagate)
+		mutations = append(mutations, templateOverridesMutation(requestGVK(request.Request), overrides))
 	}
 
+	// the values set by the workload overrides are restricted too
+	labelsToPropagate, err := applyLabelValues(labelsToPropagate, request.Request, settings)
+	if err != nil {
+		return rejectWithError(err)
+	}
+	if settings.ContainerEnv != nil {
+		mutations = append(mutations, containerEnvMutation(namespaceLabels, settings.ContainerEnv))
+	}
+	if settings.Scheduling != nil {
+		mutations = append(mutations, schedulingMutation(namespaceLabels, settings.Scheduling))
+	}
+	if len(settings.PodDefaults) > 0 {
+		mutations = append(mutations, podDefaultsMutation(requestGVK(request.Request), namespaceLabels, settings.PodDefaults))
+	}
+	return updateResourceLabels(request, labelsToPropagate, settings.OnCreateOnly, mutations...)
+}
+
+// objectMutation changes the object sent inside of the request, besides its
+// labels. The pod spec is nil when the object does not define one, or when
+// it cannot be changed: the spec of a Pod is immutable once created. Returns
+// `true` when the object has been changed.
+type objectMutation func(object map[string]interface{}, podSpec map[string]interface{}) (bool, error)
+
+// propagateLabels ensures the given labels map contains the same labels
+// defined in the `labelsToPropagate` map. The labels found in `keptLabels`
+// get their kept value instead of the one to propagate. Returns `true` when
+// the labels map has been changed
+func propagateLabels(labels map[string]interface{}, labelsToPropagate map[string]string, keptLabels map[string]interface{}) bool {
 	hasMutation := false
-	for label, newValue := range labelsToPropagate {
-		if oldValue, has_label := meta.Labels[label]; !has_label || oldValue != newValue {
-			meta.Labels[label] = newValue
+	for label, propagatedValue := range labelsToPropagate {
+		var newValue interface{} = propagatedValue
+		if keptValue, kept := keptLabels[label]; kept {
+			newValue = keptValue
+		}
+		if oldValue, has_label := labels[label]; !has_label || oldValue != newValue {
+			labels[label] = newValue
 			hasMutation = true
 		}
 	}
 	return hasMutation
 }
 
-func updateResourceLabels(object kubewarden_protocol.ValidationRequest, labelsToPropagate map[string]string) ([]byte, error) {
-	switch strings.ToLower(object.Request.Kind.Kind) {
-	case DEPLOYMENT_KIND:
-		deployment := appsv1.Deployment{}
-		if err := json.Unmarshal(object.Request.Object, &deployment); err != nil {
-			return nil, err
-		}
-		objChanged := propagateLabels(deployment.Metadata, labelsToPropagate)
-		podSpecChanged := propagateLabels(deployment.Spec.Template.Metadata, labelsToPropagate)
-		if objChanged || podSpecChanged {
-			return kubewarden.MutateRequest(deployment)
-		}
-	case REPLICASET_KIND:
-		replicaset := appsv1.ReplicaSet{}
-		if err := json.Unmarshal(object.Request.Object, &replicaset); err != nil {
-			return nil, err
-		}
-		objChanged := propagateLabels(replicaset.Metadata, labelsToPropagate)
-		podSpecChanged := propagateLabels(replicaset.Spec.Template.Metadata, labelsToPropagate)
-		if objChanged || podSpecChanged {
-			return kubewarden.MutateRequest(replicaset)
-		}
-	case STATEFULSET_KIND:
-		statefulset := appsv1.StatefulSet{}
-		if err := json.Unmarshal(object.Request.Object, &statefulset); err != nil {
-			return nil, err
-		}
-		objChanged := propagateLabels(statefulset.Metadata, labelsToPropagate)
-		podSpecChanged := propagateLabels(statefulset.Spec.Template.Metadata, labelsToPropagate)
-		if objChanged || podSpecChanged {
-			return kubewarden.MutateRequest(statefulset)
-		}
-	case DAEMONSET_KIND:
-		daemonset := appsv1.DaemonSet{}
-		if err := json.Unmarshal(object.Request.Object, &daemonset); err != nil {
-			return nil, err
-		}
-		objChanged := propagateLabels(daemonset.Metadata, labelsToPropagate)
-		podSpecChanged := propagateLabels(daemonset.Spec.Template.Metadata, labelsToPropagate)
-		if objChanged || podSpecChanged {
-			return kubewarden.MutateRequest(daemonset)
-		}
-	case REPLICATIONCONTROLLER_KIND:
-		replicationController := corev1.ReplicationController{}
-		if err := json.Unmarshal(object.Request.Object, &replicationController); err != nil {
-			return nil, err
-		}
-		objChanged := propagateLabels(replicationController.Metadata, labelsToPropagate)
-		podSpecChanged := propagateLabels(replicationController.Spec.Template.Metadata, labelsToPropagate)
-		if objChanged || podSpecChanged {
-			return kubewarden.MutateRequest(replicationController)
+// keptLabels returns the labels of the old object, found in the metadata at
+// the given path, whose values must not change. Only the labels listed in
+// `onCreateOnly` are returned.
+func keptLabels(oldResource map[string]interface{}, metadataPath []string, onCreateOnly []string) map[string]interface{} {
+	kept := make(map[string]interface{})
+	labels, found := nestedMap(oldResource, append(slices.Clone(metadataPath), "labels")...)
+	if !found {
+		return kept
+	}
+	for _, label := range onCreateOnly {
+		if value, has_label := labels[label]; has_label {
+			kept[label] = value
 		}
-	case CRONJOB_KIND:
-		cronjob := batchv1.CronJob{}
-		if err := json.Unmarshal(object.Request.Object, &cronjob); err != nil {
+	}
+	return kept
+}
+
+// updateResourceLabels propagates the labels to the object, to the templates
+// of its pods and to the claim templates of their ephemeral volumes, then
+// applies the given mutations. On UPDATE, the labels listed in `onCreateOnly`
+// keep the value they have in the old object. Requests are rejected when a
+// mutation fails.
+func updateResourceLabels(object kubewarden_protocol.ValidationRequest, labelsToPropagate map[string]string, onCreateOnly []string, mutations ...objectMutation) ([]byte, error) {
+	gvk := requestGVK(object.Request)
+	paths, supported := metadataPaths[gvk]
+	if !supported {
+		return nil, unsupportedKindError(gvk)
+	}
+
+	resource, err := decodeObject(object.Request.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldResource map[string]interface{}
+	if object.Request.Operation == "UPDATE" && len(onCreateOnly) > 0 && len(object.Request.OldObject) > 0 {
+		oldResource, err = decodeObject(object.Request.OldObject)
+		if err != nil {
 			return nil, err
 		}
-		objChanged := propagateLabels(cronjob.Metadata, labelsToPropagate)
-		podSpecChanged := propagateLabels(cronjob.Spec.JobTemplate.Spec.Template.Metadata, labelsToPropagate)
-		if objChanged || podSpecChanged {
-			return kubewarden.MutateRequest(cronjob)
-		}
-	case JOB_KIND:
-		job := batchv1.Job{}
-		if err := json.Unmarshal(object.Request.Object, &job); err != nil {
+	}
+
+	hasMutation := false
+	for _, path := range paths {
+		labels, found, err := metadataLabels(resource, path)
+		if err != nil {
 			return nil, err
 		}
-		objChanged := propagateLabels(job.Metadata, labelsToPropagate)
-		podSpecChanged := propagateLabels(job.Spec.Template.Metadata, labelsToPropagate)
-		if objChanged || podSpecChanged {
-			return kubewarden.MutateRequest(job)
-		}
-	case POD_KIND:
-		pod := corev1.Pod{}
-		if err := json.Unmarshal(object.Request.Object, &pod); err != nil {
-			return nil, err
+		if found && propagateLabels(labels, labelsToPropagate, keptLabels(oldResource, path, onCreateOnly)) {
+			hasMutation = true
 		}
-		objChanged := propagateLabels(pod.Metadata, labelsToPropagate)
-		if objChanged {
-			return kubewarden.MutateRequest(pod)
+	}
+
+	var podSpec, oldPodSpec map[string]interface{}
+	if path, hasPodSpec := podSpecPaths[gvk]; hasPodSpec && !(gvk == POD_KIND && object.Request.Operation == "UPDATE") {
+		podSpec, _ = nestedMap(resource, path...)
+		oldPodSpec, _ = nestedMap(oldResource, path...)
+	}
+	mutations = append([]objectMutation{ephemeralVolumesMutation(labelsToPropagate, oldPodSpec, onCreateOnly)}, mutations...)
+	for _, mutation := range mutations {
+		changed, err := mutation(resource, podSpec)
+		if err != nil {
+			return rejectWithError(err)
 		}
-	default:
-		return nil, fmt.Errorf("object should be one of these kinds: Deployment, ReplicaSet, StatefulSet, DaemonSet, ReplicationController, Job, CronJob, Pod. Found %s", object.Request.Kind.Kind)
+		hasMutation = hasMutation || changed
+	}
+	if hasMutation {
+		return kubewarden.MutateRequest(resource)
 	}
 	return kubewarden.AcceptRequest()
 }
@@ -183,10 +188,63 @@ func validate(payload []byte) ([]byte, error) {
 			kubewarden.Code(400))
 	}
 
-	namespace, err := getNamespace(validationRequest)
+	// The exemptions apply only to the propagation of the labels, the
+	// namespaces are always defaulted, validated and protected.
+	gvk := requestGVK(validationRequest.Request)
+	if reason := settings.exemptionReason(validationRequest.Request.UserInfo); reason != "" && gvk != NAMESPACE_KIND {
+		logger.InfoWith("request exempted from label propagation").
+			String("uid", validationRequest.Request.Uid).
+			String("reason", reason).
+			Write()
+		return kubewarden.AcceptRequest()
+	}
+
+	if _, supported := metadataPaths[gvk]; !supported {
+		if settings.UnsupportedKinds == UNSUPPORTED_KINDS_IGNORE {
+			logger.DebugWith("ignoring unsupported kind").
+				String("kind", formatGVK(gvk)).
+				Write()
+			return kubewarden.AcceptRequest()
+		}
+		return kubewarden.RejectRequest(kubewarden.Message(unsupportedKindError(gvk).Error()), kubewarden.Code(400))
+	}
+
+	if gvk == NAMESPACE_KIND {
+		return validateNamespace(validationRequest, settings)
+	}
+
+	if gvk == PERSISTENTVOLUME_KIND {
+		namespaceName, bound, err := claimNamespace(validationRequest.Request)
+		if err != nil {
+			return kubewarden.RejectRequest(kubewarden.Message(err.Error()), kubewarden.Code(400))
+		}
+		if !bound {
+			logger.DebugWith("ignoring persistent volume not bound to a claim").
+				String("uid", validationRequest.Request.Uid).
+				Write()
+			return kubewarden.AcceptRequest()
+		}
+		validationRequest.Request.Namespace = namespaceName
+	}
+
+	namespace, err := getNamespace(validationRequest, settings)
+	if gvk == PERSISTENTVOLUME_KIND && isLookupNotFound(err) {
+		// volumes outlive the namespace of their claim: rejecting them would
+		// block their release and reclaim forever
+		logger.WarnWith("ignoring persistent volume whose claim namespace does not exist").
+			String("uid", validationRequest.Request.Uid).
+			String("namespace", validationRequest.Request.Namespace).
+			Write()
+		return kubewarden.AcceptRequest()
+	}
+	if err != nil {
+		return handleLookupFailure(validationRequest, settings, err)
+	}
+
+	labels, err := propagationCandidates(namespace, validationRequest, settings)
 	if err != nil {
-		return kubewarden.RejectRequest(kubewarden.Message(err.Error()), kubewarden.Code(400))
+		return handleLookupFailure(validationRequest, settings, err)
 	}
 
-	return validateResourceLabels(namespace.Metadata.Labels, validationRequest, settings)
+	return validateResourceLabels(labels, validationRequest, settings)
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"testing"
 
@@ -23,7 +24,7 @@ const SHOULD_MUTATE = true
 const NO_MUTATION = false
 const TEST_NAMESPACE = "default"
 
-func buildValidationRequest(propagatedLabels []string, resource interface{}, kind string) ([]byte, error) {
+func buildValidationRequest(propagatedLabels []string, resource interface{}, kind kubewarden_protocol.GroupVersionKind) ([]byte, error) {
 	settings := Settings{PropagatedLabels: propagatedLabels}
 	payload, err := kubewarden_testing.BuildValidationRequest(resource, &settings)
 
@@ -73,17 +74,64 @@ func validateLabels(resourceLabels, expectedLabels map[string]string) error {
 	return nil
 }
 
-func updateValidationRequestKindAndNamespace(payload []byte, kind string) ([]byte, error) {
+func updateValidationRequestKindAndNamespace(payload []byte, kind kubewarden_protocol.GroupVersionKind) ([]byte, error) {
 	validationRequest := kubewarden_protocol.ValidationRequest{}
 	err := json.Unmarshal(payload, &validationRequest)
 	if err != nil {
 		return nil, err
 	}
-	validationRequest.Request.Kind.Kind = kind
+	validationRequest.Request.Kind = kind
 	validationRequest.Request.Namespace = TEST_NAMESPACE
 	return json.Marshal(validationRequest)
 }
 
+// updateValidationRequestSettings changes the settings of the validation
+// request payload using the given function.
+func updateValidationRequestSettings(payload []byte, update func(*Settings)) ([]byte, error) {
+	validationRequest := kubewarden_protocol.ValidationRequest{}
+	if err := json.Unmarshal(payload, &validationRequest); err != nil {
+		return nil, err
+	}
+	settings, err := NewSettingsFromValidationReq(&validationRequest)
+	if err != nil {
+		return nil, err
+	}
+	update(&settings)
+	validationRequest.Settings, err = json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(validationRequest)
+}
+
+// updateValidationRequest changes the admission request of the validation
+// request payload using the given function.
+func updateValidationRequest(payload []byte, update func(*kubewarden_protocol.KubernetesAdmissionRequest)) ([]byte, error) {
+	validationRequest := kubewarden_protocol.ValidationRequest{}
+	if err := json.Unmarshal(payload, &validationRequest); err != nil {
+		return nil, err
+	}
+	update(&validationRequest.Request)
+	return json.Marshal(validationRequest)
+}
+
+// mutatedPodLabels returns the labels of the Pod mutated by the policy.
+func mutatedPodLabels(responsePayload []byte) (map[string]string, error) {
+	response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, SHOULD_MUTATE)
+	if err != nil {
+		return nil, err
+	}
+	mutatedResourceJSON, err := json.Marshal(response.MutatedObject)
+	if err != nil {
+		return nil, err
+	}
+	pod := corev1.Pod{}
+	if err := json.Unmarshal(mutatedResourceJSON, &pod); err != nil {
+		return nil, err
+	}
+	return pod.Metadata.Labels, nil
+}
+
 func TestPodWithNoLabels(t *testing.T) {
 	propagatedLabels := []string{"testing"}
 	namespaceLabels := map[string]string{
@@ -221,7 +269,7 @@ func TestLabelsShouldOverwrittenLabelsOnlyDefinedInSettings(t *testing.T) {
 		namespaceLabels  map[string]string
 		expectedLabels   map[string]string
 		resource         interface{}
-		kind             string
+		kind             kubewarden_protocol.GroupVersionKind
 		accept           bool
 		mutate           bool
 	}{
@@ -397,7 +445,7 @@ func TestLabelsShouldOverwrittenLabelsOnlyDefinedInSettings(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		t.Run(tc.kind, func(t *testing.T) {
+		t.Run(tc.kind.Kind, func(t *testing.T) {
 			payload, err := buildValidationRequest(tc.propagatedLabels, tc.resource, tc.kind)
 			if err != nil {
 				t.Errorf("Unexpected error: %+v", err)
@@ -531,8 +579,176 @@ func TestLabelsShouldOverwrittenLabelsOnlyDefinedInSettings(t *testing.T) {
 					t.Error(err.Error())
 				}
 			default:
-				t.Errorf("Unexpected kind: %s", tc.kind)
+				t.Errorf("Unexpected kind: %s", formatGVK(tc.kind))
+			}
+		})
+	}
+}
+
+func TestUnsupportedKinds(t *testing.T) {
+	cases := []struct {
+		name             string
+		unsupportedKinds string
+		kind             kubewarden_protocol.GroupVersionKind
+		accept           bool
+	}{
+		{"CRD named Job is rejected by default", "", kubewarden_protocol.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Job"}, SHOULD_REJECT},
+		{"CRD named Job is rejected", UNSUPPORTED_KINDS_REJECT, kubewarden_protocol.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Job"}, SHOULD_REJECT},
+		{"CRD named Deployment is ignored", UNSUPPORTED_KINDS_IGNORE, kubewarden_protocol.GroupVersionKind{Group: "example.com", Version: "v1alpha1", Kind: "Deployment"}, SHOULD_ACCEPT},
+		{"Old Deployment version is rejected", UNSUPPORTED_KINDS_REJECT, kubewarden_protocol.GroupVersionKind{Group: "apps", Version: "v1beta1", Kind: "Deployment"}, SHOULD_REJECT},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := Settings{PropagatedLabels: []string{"testing"}, UnsupportedKinds: tc.unsupportedKinds}
+			payload, err := kubewarden_testing.BuildValidationRequest(map[string]interface{}{"metadata": map[string]interface{}{"name": "test"}}, &settings)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestKindAndNamespace(payload, tc.kind)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+
+			// no host capability is expected to be called for unsupported kinds
+			host.Client = mocks.NewMockWapcClient(t)
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, tc.accept, NO_MUTATION)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if !tc.accept && !strings.Contains(*response.Message, "apps/v1 Deployment") {
+				t.Errorf("Rejection message should list the supported kinds: %s", *response.Message)
 			}
 		})
 	}
 }
+
+func TestConvertedRequestUsesKind(t *testing.T) {
+	validationRequest := kubewarden_protocol.ValidationRequest{}
+	validationRequest.Request.Kind = DEPLOYMENT_KIND
+	validationRequest.Request.RequestKind = kubewarden_protocol.GroupVersionKind{Group: "apps", Version: "v1beta2", Kind: "Deployment"}
+	validationRequest.Request.Object = []byte(`{"metadata": {"name": "test"}, "spec": {"template": {"metadata": {}}}}`)
+
+	responsePayload, err := updateResourceLabels(validationRequest, map[string]string{"testing": "foo"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if _, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, SHOULD_MUTATE); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestOnCreateOnlyLabels(t *testing.T) {
+	jobWithLabels := func(labels map[string]string) batchv1.Job {
+		volumeName := "scratch"
+		return batchv1.Job{
+			Metadata: &metav1.ObjectMeta{Name: "test", Namespace: TEST_NAMESPACE, Labels: labels},
+			Spec: &batchv1.JobSpec{
+				Template: &corev1.PodTemplateSpec{
+					Metadata: &metav1.ObjectMeta{Labels: labels},
+					Spec: &corev1.PodSpec{Volumes: []*corev1.Volume{{
+						Name: &volumeName,
+						Ephemeral: &corev1.EphemeralVolumeSource{VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+							Metadata: &metav1.ObjectMeta{Labels: labels},
+							Spec:     &corev1.PersistentVolumeClaimSpec{},
+						}},
+					}}},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name           string
+		operation      string
+		oldLabels      map[string]string
+		expectedLabels map[string]string
+	}{
+		{
+			"create sets the namespace value",
+			"CREATE",
+			nil,
+			map[string]string{"cost-center": "finance", "team": "platform"},
+		},
+		{
+			"update keeps the old value",
+			"UPDATE",
+			map[string]string{"cost-center": "marketing", "team": "web"},
+			map[string]string{"cost-center": "marketing", "team": "platform"},
+		},
+		{
+			"update sets the namespace value when the old object has none",
+			"UPDATE",
+			map[string]string{"team": "web"},
+			map[string]string{"cost-center": "finance", "team": "platform"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := buildValidationRequest([]string{"cost-center", "team"}, jobWithLabels(nil), JOB_KIND)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequestSettings(payload, func(settings *Settings) {
+				settings.OnCreateOnly = []string{"cost-center"}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			payload, err = updateValidationRequest(payload, func(request *kubewarden_protocol.KubernetesAdmissionRequest) {
+				request.Operation = tc.operation
+				if tc.operation == "UPDATE" {
+					request.OldObject, _ = json.Marshal(jobWithLabels(tc.oldLabels))
+				}
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			mockNamespaceLabels(t, map[string]string{"cost-center": "finance", "team": "platform"})
+
+			responsePayload, err := validate(payload)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			response, err := basicResposeValidation(responsePayload, SHOULD_ACCEPT, SHOULD_MUTATE)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			mutatedResourceJSON, err := json.Marshal(response.MutatedObject)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			job := batchv1.Job{}
+			if err := json.Unmarshal(mutatedResourceJSON, &job); err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if err := validateLabels(job.Metadata.Labels, tc.expectedLabels); err != nil {
+				t.Error(err.Error())
+			}
+			if err := validateLabels(job.Spec.Template.Metadata.Labels, tc.expectedLabels); err != nil {
+				t.Errorf("pod template: %s", err.Error())
+			}
+			claimTemplate := job.Spec.Template.Spec.Volumes[0].Ephemeral.VolumeClaimTemplate
+			if err := validateLabels(claimTemplate.Metadata.Labels, tc.expectedLabels); err != nil {
+				t.Errorf("ephemeral volume claim template: %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestOnCreateOnlySettingsValidation(t *testing.T) {
+	settings := Settings{PropagatedLabels: []string{"team"}, OnCreateOnly: []string{"cost-center"}}
+	if valid, _ := settings.Valid(); valid {
+		t.Errorf("Expected onCreateOnly labels that are not propagated to be rejected")
+	}
+	settings.PropagatedLabels = append(settings.PropagatedLabels, "cost-center")
+	if valid, err := settings.Valid(); !valid {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+}
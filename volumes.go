@@ -0,0 +1,50 @@
+package main
+
+import "fmt"
+
+// ephemeralVolumesMutation returns the mutation propagating the labels to
+// the claim templates of the generic ephemeral volumes of the pod spec. The
+// PersistentVolumeClaims created from these templates are then labeled like
+// the workload. The labels listed in `onCreateOnly` keep the value found
+// inside of the claim template of the volume with the same name in the old
+// pod spec, which is nil on CREATE.
+func ephemeralVolumesMutation(labelsToPropagate map[string]string, oldPodSpec map[string]interface{}, onCreateOnly []string) objectMutation {
+	return func(object map[string]interface{}, podSpec map[string]interface{}) (bool, error) {
+		if podSpec == nil {
+			return false, nil
+		}
+		volumes, _ := podSpec["volumes"].([]interface{})
+		hasMutation := false
+		for _, item := range volumes {
+			volume, isMap := item.(map[string]interface{})
+			if !isMap {
+				continue
+			}
+			ephemeral, found := nestedMap(volume, "ephemeral")
+			if !found {
+				continue
+			}
+			labels, found, err := metadataLabels(ephemeral, []string{"volumeClaimTemplate", "metadata"})
+			if err != nil {
+				return false, fmt.Errorf("volume %v: %w", volume["name"], err)
+			}
+			kept := keptLabels(findVolume(oldPodSpec, volume["name"]), []string{"ephemeral", "volumeClaimTemplate", "metadata"}, onCreateOnly)
+			if found && propagateLabels(labels, labelsToPropagate, kept) {
+				hasMutation = true
+			}
+		}
+		return hasMutation, nil
+	}
+}
+
+// findVolume returns the volume with the given name defined by the pod spec,
+// or nil when there is none.
+func findVolume(podSpec map[string]interface{}, name interface{}) map[string]interface{} {
+	volumes, _ := podSpec["volumes"].([]interface{})
+	for _, item := range volumes {
+		if volume, isMap := item.(map[string]interface{}); isMap && volume["name"] == name {
+			return volume
+		}
+	}
+	return nil
+}
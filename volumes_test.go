@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEphemeralVolumesMutation(t *testing.T) {
+	labelsToPropagate := map[string]string{"cost-center": "finance"}
+
+	cases := []struct {
+		name        string
+		podSpec     string
+		valid       bool
+		mutated     bool
+		expectedPod string
+	}{
+		{
+			"claim template without metadata",
+			`{"volumes":[{"ephemeral":{"volumeClaimTemplate":{"spec":{}}},"name":"scratch"}]}`,
+			true,
+			true,
+			`{"volumes":[{"ephemeral":{"volumeClaimTemplate":{"metadata":{"labels":{"cost-center":"finance"}},"spec":{}}},"name":"scratch"}]}`,
+		},
+		{
+			"claim template already labeled",
+			`{"volumes":[{"ephemeral":{"volumeClaimTemplate":{"metadata":{"labels":{"cost-center":"finance"}}}},"name":"scratch"}]}`,
+			true,
+			false,
+			`{"volumes":[{"ephemeral":{"volumeClaimTemplate":{"metadata":{"labels":{"cost-center":"finance"}}}},"name":"scratch"}]}`,
+		},
+		{
+			"other volumes",
+			`{"volumes":[{"emptyDir":{},"name":"cache"},{"ephemeral":{},"name":"scratch"}]}`,
+			true,
+			false,
+			`{"volumes":[{"emptyDir":{},"name":"cache"},{"ephemeral":{},"name":"scratch"}]}`,
+		},
+		{
+			"invalid labels",
+			`{"volumes":[{"ephemeral":{"volumeClaimTemplate":{"metadata":{"labels":"finance"}}},"name":"scratch"}]}`,
+			false,
+			false,
+			"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			podSpec, err := decodeObject([]byte(tc.podSpec))
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			mutated, err := ephemeralVolumesMutation(labelsToPropagate, nil, nil)(nil, podSpec)
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid to be %t, error: %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+			if mutated != tc.mutated {
+				t.Errorf("Expected mutated to be %t", tc.mutated)
+			}
+			result, err := json.Marshal(podSpec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %+v", err)
+			}
+			if string(result) != tc.expectedPod {
+				t.Errorf("Expected pod spec %s, found %s", tc.expectedPod, result)
+			}
+		})
+	}
+}